@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+type console struct {
+	in        io.Reader
+	out       io.Writer
+	userName  string
+	channelID string
+	serverID  string
+	// permission What whoever is at the console is allowed to do, whichever user they are sending messages as
+	permission types.Permission
+	// runID Starts every message ID so they don't collide with the ones stored by earlier runs
+	runID      string
+	messageNum int
+	dispatcher *events.Dispatcher
+	done       chan struct{}
+}
+
+const consoleName = "console"
+
+// consoleBotName Starting a message with @ and this name works as a command prefix
+const consoleBotName = "respecbot"
+
+// consolePermissions The permissions that can be taken with the /perm directive
+var consolePermissions = map[string]types.Permission{
+	"everyone":  types.Everyone,
+	"moderator": types.Moderator,
+	"admin":     types.ServerAdmin,
+}
+
+// consoleDirective Lines starting with this are handled by the console itself instead of being sent as messages
+const consoleDirective = "/"
+
+func (c console) String() string {
+	return consoleName
+}
+
+var _ types.API = (*console)(nil)
+var _ types.PermissionAPI = (*console)(nil)
+
+// NewConsole Create an API that reads messages from 'in' and writes replies to 'out'.
+// Messages are sent as the given user in the given channel and server until changed with a directive
+func NewConsole(in io.Reader, out io.Writer, user, channel, server string) (types.API, error) {
+	if user == "" || channel == "" || server == "" {
+		return nil, fmt.Errorf("Console user, channel, and server must all be set")
+	}
+	c := new(console)
+	c.in = in
+	c.out = out
+	c.userName = user
+	c.channelID = channel
+	c.serverID = server
+	c.runID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	c.dispatcher = events.NewDispatcher(c)
+	c.done = make(chan struct{})
+	return c, nil
+}
+
+func (c *console) Setup() error {
+	logging.Log("Setting up respecbot on console")
+	fmt.Fprintln(c.out, "Type messages to send them. Directives:")
+	fmt.Fprintln(c.out, "  /user <name>     send messages as <name>")
+	fmt.Fprintln(c.out, "  /channel <name>  send messages in <name>")
+	fmt.Fprintln(c.out, "  /server <name>   send messages in <name>")
+	fmt.Fprintln(c.out, "  /perm <level>    send messages as everyone, a moderator, or an admin")
+	fmt.Fprintln(c.out, "  /quit            stop listening")
+	fmt.Fprintln(c.out, "Mention users with @name, start a message with @"+consoleBotName+" to give a command")
+	return nil
+}
+
+func (c *console) Listen() error {
+	logging.Log("Console api listening")
+	lines := make(chan string)
+	done := make(chan error, 1)
+	// stopped Lets the scanner finish once nothing is reading its lines any more
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		scanner := bufio.NewScanner(c.in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-stopped:
+				return
+			}
+		}
+		done <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			if !c.handleLine(line) {
+				return nil
+			}
+		case err := <-done:
+			return err
+		case <-c.done:
+			return nil
+		}
+	}
+}
+
+func (c *console) Close() error {
+	close(c.done)
+	return nil
+}
+
+func (c *console) ReplyTo(reply *types.Reply, message *types.Message) error {
+	_, err := fmt.Fprintf(c.out, "[%v] respecbot: %v\n", message.Channel.ID, reply)
+	return err
+}
+
+func (c *console) MaxMessageLength() int {
+	return 0
+}
+
+// UserPermission The permission taken with /perm, whichever user messages are sent as. Everyone until one is taken
+func (c *console) UserPermission(channel *types.Channel, user *types.User) (types.Permission, error) {
+	return c.permission, nil
+}
+
+func (c *console) HandleCommand(message *types.Message) error {
+	commands.HandleCommand(c, message)
+	return nil
+}
+
+func (c *console) GetUser(userID string) *types.User {
+	return db.GetUser(userID, consoleName)
+}
+
+func (c *console) GetChannel(channelID string) *types.Channel {
+	return db.GetChannel(channelID, consoleName)
+}
+
+func (c *console) GetServer(serverID string) *types.Server {
+	return db.GetServer(serverID, consoleName)
+}
+
+// handleLine Handle a single line of input. Returns false if the console should stop listening
+func (c *console) handleLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+
+	if strings.HasPrefix(line, consoleDirective) {
+		return c.handleDirective(strings.TrimPrefix(line, consoleDirective))
+	}
+
+	msg := c.createMessage(line)
+
+	c.dispatcher.Dispatch(events.MessageCreated{Message: msg})
+	return true
+}
+
+func (c *console) handleDirective(directive string) bool {
+	args := strings.Fields(directive)
+	if len(args) == 0 {
+		return true
+	}
+	switch args[0] {
+	case "quit":
+		return false
+	case "user", "channel", "server":
+		if len(args) != 2 {
+			fmt.Fprintf(c.out, "Usage: /%v <name>\n", args[0])
+			return true
+		}
+		switch args[0] {
+		case "user":
+			c.userName = args[1]
+		case "channel":
+			c.channelID = args[1]
+		case "server":
+			c.serverID = args[1]
+		}
+		fmt.Fprintf(c.out, "Now %v in %v on %v\n", c.userName, c.channelID, c.serverID)
+	case "perm":
+		permission, ok := consolePermissions[strings.Join(args[1:], " ")]
+		if !ok {
+			fmt.Fprintln(c.out, "Usage: /perm <everyone|moderator|admin>")
+			return true
+		}
+		c.permission = permission
+		fmt.Fprintf(c.out, "Now sending messages as %v\n", permission)
+	default:
+		fmt.Fprintf(c.out, "Unknown directive /%v\n", args[0])
+	}
+	return true
+}
+
+func (c *console) createMessage(content string) *types.Message {
+	msg := new(types.Message)
+
+	author := c.getUser(c.userName)
+	msg.Author = author
+	msg.UserKey = author.Key
+
+	channel := c.getChannel(c.channelID, c.serverID)
+	msg.Channel = channel
+	msg.ChannelKey = channel.Key
+
+	content, msg.Addressed = types.TrimMention(content, "@"+consoleBotName)
+	msg.Mentions = c.getMentionedUsers(content)
+
+	c.messageNum++
+	msg.Content = content
+	msg.Time = time.Now()
+	msg.ID = c.runID + "-" + strconv.Itoa(c.messageNum)
+
+	msg.APIID = consoleName
+
+	return msg
+}
+
+// getMentionedUsers Every word starting with '@' is a mention of the user with that name
+func (c *console) getMentionedUsers(content string) []*types.User {
+	var users []*types.User
+	userMap := make(map[string]*types.User)
+
+	for _, v := range strings.Fields(content) {
+		if !strings.HasPrefix(v, "@") {
+			continue
+		}
+		name := strings.TrimRight(strings.TrimPrefix(v, "@"), ".,!?:;")
+		if name == "" {
+			continue
+		}
+		if _, ok := userMap[name]; !ok {
+			user := c.getUser(name)
+			userMap[name] = user
+			users = append(users, user)
+		}
+	}
+
+	return users
+}
+
+func (c *console) getUser(name string) *types.User {
+	user := db.GetUser(name, consoleName)
+	if user == nil {
+		user = new(types.User)
+		user.ID = name
+		user.Name = name
+		user.APIID = consoleName
+		db.NewUser(user)
+	}
+	return user
+}
+
+// getChannel Channel IDs are only unique within a server, so the stored ID includes the server
+func (c *console) getChannel(channelName, serverID string) *types.Channel {
+	channelID := serverID + "#" + channelName
+	channel := db.GetChannel(channelID, consoleName)
+	if channel == nil {
+		channel = new(types.Channel)
+		channel.ID = channelID
+		channel.Server = c.getServer(serverID)
+		channel.ServerKey = channel.Server.Key
+		channel.APIID = consoleName
+		channel.Active = false
+		db.NewChannel(channel)
+	}
+	return channel
+}
+
+func (c *console) getServer(serverID string) *types.Server {
+	server := db.GetServer(serverID, consoleName)
+	if server == nil {
+		server = new(types.Server)
+		server.ID = serverID
+		server.APIID = consoleName
+		db.NewServer(server)
+	}
+	return server
+}
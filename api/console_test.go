@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
+)
+
+// consoleOutput Replies are written from the outbox's goroutines while directives are answered from Listen
+type consoleOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *consoleOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func TestConsole(t *testing.T) {
+	if err := db.Setup("consoletest.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteDB("consoletest.db")
+	defer db.Close()
+	outbox.Replies = outbox.NewQueue(0, 0)
+
+	// Lines after /quit are never read
+	in := strings.NewReader("%lookatme\n/perm owner\n/perm moderator\n%lookatme\n/quit\n%version\n")
+	out := new(consoleOutput)
+	a, err := NewConsole(in, out, "alice", "general", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- a.Listen()
+	}()
+	select {
+	case err = <-listening:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after /quit")
+	}
+	outbox.Flush()
+
+	// Replies are sent in order, but not in order with the answers to directives
+	output := out.buf.String()
+	if !strings.Contains(output, "You need to be a moderator to use `lookatme`\n") || !strings.Contains(output, "Usage: /perm") ||
+		!strings.Contains(output, "Now sending messages as a moderator") || !strings.Contains(output, "Fuck on me") ||
+		strings.Index(output, "You need to be") > strings.Index(output, "Fuck on me") || strings.Contains(output, "Version") {
+		t.Errorf("Unexpected output:\n%v", output)
+	}
+}
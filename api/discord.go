@@ -2,36 +2,47 @@ package api
 
 import (
 	"fmt"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 
 	"github.com/Jaggernaut555/respecbot-v2/commands"
 	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
 	"github.com/Jaggernaut555/respecbot-v2/logging"
-	"github.com/Jaggernaut555/respecbot-v2/rate"
 	"github.com/Jaggernaut555/respecbot-v2/types"
 	"github.com/bwmarrin/discordgo"
 )
 
 type discord struct {
 	*discordgo.Session
+	dispatcher *events.Dispatcher
+	done       chan struct{}
+	rolesMu    sync.Mutex
+	// roleIDs The ID of each role by name, for every guild whose roles have been fetched
+	roleIDs        map[string]map[string]string
+	interactionsMu sync.Mutex
+	// interactions Slash commands that can still be replied to, by ID
+	interactions map[string]*discordInteraction
 }
 
 const discordName = "discord"
 
+// Limits on the length of messages and embeds sent to discord
 const (
-	supremeRoleName = "Supreme Ruler"
-	rulingRoleName  = "Ruling Class"
-	loserRoleName   = "Losers"
+	discordMaxLength           = 2000
+	discordMaxEmbedDescription = 2048
+	discordMaxEmbedFieldValue  = 1024
 )
 
-func (d discord) String() string {
+func (d *discord) String() string {
 	return discordName
 }
 
 var _ types.API = (*discord)(nil)
+var _ types.RoleAPI = (*discord)(nil)
+var _ types.PermissionAPI = (*discord)(nil)
+var _ types.TierAPI = (*discord)(nil)
 var session discord
 
 func NewDiscord(token string) (types.API, error) {
@@ -45,6 +56,10 @@ func NewDiscord(token string) (types.API, error) {
 		logging.Log("error creating Discord session,", err.Error())
 		return nil, err
 	}
+	session.dispatcher = events.NewDispatcher(&session)
+	session.done = make(chan struct{})
+	session.roleIDs = make(map[string]map[string]string)
+	session.interactions = make(map[string]*discordInteraction)
 
 	return &session, nil
 }
@@ -55,6 +70,14 @@ func (d *discord) Setup() error {
 	d.Session.AddHandler(messageCreate)
 	d.Session.AddHandler(reactionAdd)
 	d.Session.AddHandler(reactionRemove)
+	d.Session.AddHandler(guildMemberAdd)
+	d.Session.AddHandler(guildCreate)
+	d.Session.AddHandler(guildMemberUpdate)
+	d.Session.AddHandler(guildRoleCreate)
+	d.Session.AddHandler(guildRoleUpdate)
+	d.Session.AddHandler(guildRoleDelete)
+	d.Session.AddHandler(ready)
+	d.Session.AddHandler(interactionCreate)
 
 	err := d.Session.Open()
 	if err != nil {
@@ -64,18 +87,86 @@ func (d *discord) Setup() error {
 	return nil
 }
 
+// Listen Blocks until Close is called, events are handled by discordgo
 func (d *discord) Listen() error {
 	logging.Log("Discord api listening")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
-	<-sc
+	<-d.done
+	return nil
+}
 
+func (d *discord) Close() error {
+	close(d.done)
 	return d.Session.Close()
 }
 
-func (d *discord) ReplyTo(reply string, message *types.Message) error {
-	_, err := d.ChannelMessageSend(message.Channel.ID, reply)
-	return err
+// ReplyTo Replies with more than text are sent as embeds. Anything too long for one message is split over several.
+// Replies to slash commands are sent as responses to them, and pages of a longer reply get buttons to turn the page
+func (d *discord) ReplyTo(reply *types.Reply, message *types.Message) error {
+	if ok, err := d.replyToInteraction(reply, message); ok {
+		return err
+	}
+	var parts []*discordgo.MessageSend
+	if reply.IsText() {
+		for _, v := range types.SplitMessage(reply.Text, d.MaxMessageLength()) {
+			parts = append(parts, &discordgo.MessageSend{Content: v})
+		}
+	} else {
+		for _, v := range discordEmbeds(reply) {
+			parts = append(parts, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{v}})
+		}
+	}
+	if len(parts) > 0 {
+		parts[len(parts)-1].Components = discordComponents(reply.Paging)
+	}
+	for _, v := range parts {
+		if _, err := d.ChannelMessageSendComplex(message.Channel.ID, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *discord) MaxMessageLength() int {
+	return discordMaxLength
+}
+
+// discordEmbeds Embeds have no tables, so the table and code go in code blocks in the description.
+// A description too long for one embed is continued in the next, and the fields, footer, and image go on the last one
+func discordEmbeds(reply *types.Reply) []*discordgo.MessageEmbed {
+	var embeds []*discordgo.MessageEmbed
+
+	var description []string
+	if reply.Text != "" {
+		description = append(description, reply.Text)
+	}
+	if len(reply.Table) > 0 {
+		description = append(description, "```\n"+reply.TableString()+"```")
+	}
+	if reply.Code != "" {
+		description = append(description, "```\n"+strings.TrimRight(reply.Code, "\n")+"\n```")
+	}
+	for _, v := range types.SplitMessage(strings.Join(description, "\n"), discordMaxEmbedDescription) {
+		embeds = append(embeds, &discordgo.MessageEmbed{Description: v, Color: reply.Color})
+	}
+	embeds[0].Title = reply.Title
+	embed := embeds[len(embeds)-1]
+
+	for _, v := range reply.Fields {
+		for k, value := range types.SplitMessage(v.Value, discordMaxEmbedFieldValue) {
+			name := v.Name
+			if k > 0 {
+				name += " (continued)"
+			}
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value, Inline: v.Inline})
+		}
+	}
+	if reply.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: reply.Footer}
+	}
+	if reply.Image != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: reply.Image}
+	}
+	return embeds
 }
 
 func (d *discord) HandleCommand(message *types.Message) error {
@@ -103,25 +194,13 @@ func messageCreate(ds *discordgo.Session, message *discordgo.MessageCreate) {
 
 	msg := createMessage(message.Message)
 
-	if strings.HasPrefix(message.Content, commands.CmdChar) {
-		msg.Content = strings.TrimPrefix(msg.Content, commands.CmdChar)
-		session.HandleCommand(msg)
-		return
-	}
-
-	// rate users on everything else they get
-	if msg.Channel.Active {
-		rate.RespecMessage(msg)
-		db.NewMessage(msg)
-		updateServerStatus(msg.Channel.Server)
-	}
+	session.dispatcher.Dispatch(events.MessageCreated{Message: msg})
 }
 
 func reactionAdd(s *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
-	if giver := session.GetUser(reaction.UserID); giver.Bot {
+	if giver := session.GetUser(reaction.UserID); giver != nil && giver.Bot {
 		return
 	}
-	logging.Log("Reaction added")
 	message, err := session.ChannelMessage(reaction.ChannelID, reaction.MessageID)
 	if err != nil {
 		logging.Err(err)
@@ -129,17 +208,13 @@ func reactionAdd(s *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
 	}
 	author := getUser(message.Author)
 	channel := getChannel(reaction.ChannelID)
-	if channel.Active && reaction.UserID != author.ID {
-		rate.RespecOther(author, channel, rate.OtherValue)
-		updateServerStatus(channel.Server)
-	}
+	session.dispatcher.Dispatch(events.ReactionAdded{GiverID: reaction.UserID, Author: author, Channel: channel, Time: time.Now()})
 }
 
 func reactionRemove(s *discordgo.Session, reaction *discordgo.MessageReactionRemove) {
-	if giver := session.GetUser(reaction.UserID); giver.Bot {
+	if giver := session.GetUser(reaction.UserID); giver != nil && giver.Bot {
 		return
 	}
-	logging.Log("Reaction removed")
 	message, err := session.ChannelMessage(reaction.ChannelID, reaction.MessageID)
 	if err != nil {
 		logging.Err(err)
@@ -147,92 +222,225 @@ func reactionRemove(s *discordgo.Session, reaction *discordgo.MessageReactionRem
 	}
 	author := getUser(message.Author)
 	channel := getChannel(reaction.ChannelID)
-	if channel.Active && reaction.UserID != author.ID {
-		rate.RespecOther(author, channel, -rate.OtherValue)
-		updateServerStatus(channel.Server)
+	session.dispatcher.Dispatch(events.ReactionRemoved{GiverID: reaction.UserID, Author: author, Channel: channel, Time: time.Now()})
+}
+
+func guildMemberAdd(s *discordgo.Session, member *discordgo.GuildMemberAdd) {
+	if member.User.Bot {
+		return
 	}
+	user := getUser(member.User)
+	server := getServer(member.GuildID)
+	session.dispatcher.Dispatch(events.MemberJoined{User: user, Server: server})
 }
 
-func getRoleID(guildID, roleName string) (roleID string) {
-	roles, _ := session.GuildRoles(guildID)
-	var role *discordgo.Role
-	for _, v := range roles {
-		if v.Name == roleName {
-			role = v
-			break
-		}
+func guildCreate(s *discordgo.Session, guild *discordgo.GuildCreate) {
+	session.forgetRoles(guild.ID)
+	server := getServer(guild.ID)
+	session.dispatcher.Dispatch(events.ServerJoined{Server: server})
+}
+
+func guildMemberUpdate(s *discordgo.Session, member *discordgo.GuildMemberUpdate) {
+	if member.User == nil || member.User.Bot {
+		return
 	}
-	if role == nil {
-		return ""
+	roleNames, err := session.roleNames(member.GuildID, member.Roles)
+	if err != nil {
+		logging.Err(err)
+		return
 	}
-	return role.ID
+	user := getUser(member.User)
+	server := getServer(member.GuildID)
+	session.dispatcher.Dispatch(events.MemberUpdated{User: user, Server: server, Roles: roleNames})
 }
 
-func updateServerStatus(server *types.Server) {
-	top := db.GetServerTopUser(server)
-	ruling := db.GetServerRulingClass(server)
-	losers := db.GetServerLosers(server)
-	users := db.GetServerUsers(server)
+func guildRoleCreate(s *discordgo.Session, role *discordgo.GuildRoleCreate) {
+	rolesChanged(role.GuildID)
+}
 
-	for _, v := range users {
-		if v.UserIn(losers) {
-			makeUserLoser(server.ID, v.ID)
-			makeUserNotTop(server.ID, v.ID)
-			makeUserNotRuling(server.ID, v.ID)
-			continue
-		}
-		makeUserNotLoser(server.ID, v.ID)
-		if v.ID == top.ID {
-			makeUserTop(server.ID, v.ID)
-			makeUserRuling(server.ID, v.ID)
-			continue
-		} else {
-			makeUserNotTop(server.ID, v.ID)
-		}
-		if v.UserIn(ruling) {
-			makeUserRuling(server.ID, v.ID)
-		} else {
-			makeUserNotRuling(server.ID, v.ID)
-		}
+func guildRoleUpdate(s *discordgo.Session, role *discordgo.GuildRoleUpdate) {
+	rolesChanged(role.GuildID)
+}
+
+func guildRoleDelete(s *discordgo.Session, role *discordgo.GuildRoleDelete) {
+	rolesChanged(role.GuildID)
+}
+
+// rolesChanged Drop the cached role IDs of the guild and let the dispatcher know its roles changed
+func rolesChanged(guildID string) {
+	session.forgetRoles(guildID)
+	server := getServer(guildID)
+	session.dispatcher.Dispatch(events.RolesChanged{Server: server})
+}
+
+func (d *discord) AddRole(server *types.Server, user *types.User, roleName string) error {
+	roleID, err := d.getRoleID(server.ID, roleName)
+	if err != nil {
+		return err
 	}
+	return d.GuildMemberRoleAdd(server.ID, user.ID, roleID)
 }
 
-func makeUserLoser(guildID, userID string) {
-	roleID := getRoleID(guildID, loserRoleName)
-	userAddRole(guildID, userID, roleID)
+func (d *discord) RemoveRole(server *types.Server, user *types.User, roleName string) error {
+	roleID, err := d.getRoleID(server.ID, roleName)
+	if err != nil {
+		return err
+	}
+	return d.GuildMemberRoleRemove(server.ID, user.ID, roleID)
+}
+
+// UserPermission Managing the server makes a user an admin, and managing messages, channels, or roles makes them a moderator
+func (d *discord) UserPermission(channel *types.Channel, user *types.User) (types.Permission, error) {
+	permissions, err := d.UserChannelPermissions(user.ID, channel.ID)
+	if err != nil {
+		return types.Everyone, err
+	}
+	switch {
+	case permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0:
+		return types.ServerAdmin, nil
+	case permissions&(discordgo.PermissionManageMessages|discordgo.PermissionManageChannels|discordgo.PermissionManageRoles) != 0:
+		return types.Moderator, nil
+	}
+	return types.Everyone, nil
 }
 
-func makeUserNotLoser(guildID, userID string) {
-	roleID := getRoleID(guildID, loserRoleName)
-	userRemoveRole(guildID, userID, roleID)
+func (d *discord) TiersChanged(server *types.Server, removed []string) {
+	d.dispatcher.Dispatch(events.TiersChanged{Server: server, Removed: removed})
 }
 
-func makeUserTop(guildID, userID string) {
-	roleID := getRoleID(guildID, supremeRoleName)
-	userAddRole(guildID, userID, roleID)
+func (d *discord) MemberRoles(server *types.Server, user *types.User) ([]string, error) {
+	member, err := d.GuildMember(server.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return d.roleNames(server.ID, member.Roles)
 }
 
-func makeUserNotTop(guildID, userID string) {
-	roleID := getRoleID(guildID, supremeRoleName)
-	userRemoveRole(guildID, userID, roleID)
+func (d *discord) SetupRoles(server *types.Server, roleNames []string) (*types.RoleSetup, error) {
+	setup := new(types.RoleSetup)
+	defer d.forgetRoles(server.ID)
+
+	roles, err := d.GuildRoles(server.ID)
+	if err != nil {
+		return nil, err
+	}
+	bot, err := d.GuildMember(server.ID, d.State.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bot can only give out roles below its highest role, and only with permission to manage roles.
+	// Every member also has the @everyone role, which has the same ID as the guild
+	byID := make(map[string]*discordgo.Role)
+	for _, v := range roles {
+		byID[v.ID] = v
+	}
+	var highest *discordgo.Role
+	var permissions int64
+	for _, v := range append(bot.Roles, server.ID) {
+		role, ok := byID[v]
+		if !ok {
+			continue
+		}
+		permissions |= role.Permissions
+		if highest == nil || role.Position > highest.Position {
+			highest = role
+		}
+	}
+	canManage := permissions&(discordgo.PermissionManageRoles|discordgo.PermissionAdministrator) != 0
+	if !canManage {
+		setup.Problems = append(setup.Problems, "The bot does not have the Manage Roles permission")
+	}
+
+	byName := make(map[string]*discordgo.Role)
+	for _, v := range roles {
+		byName[v.Name] = v
+	}
+	for _, name := range roleNames {
+		role, ok := byName[name]
+		if !ok {
+			if !canManage {
+				setup.Problems = append(setup.Problems, fmt.Sprintf("Role %v is missing and the bot can't create it", name))
+				continue
+			}
+			created, err := d.GuildRoleCreate(server.ID)
+			if err != nil {
+				setup.Problems = append(setup.Problems, fmt.Sprintf("Role %v is missing and could not be created: %v", name, err))
+				continue
+			}
+			if _, err = d.GuildRoleEdit(server.ID, created.ID, name, 0, false, 0, false); err != nil {
+				d.GuildRoleDelete(server.ID, created.ID)
+				setup.Problems = append(setup.Problems, fmt.Sprintf("Role %v is missing and could not be created: %v", name, err))
+				continue
+			}
+			setup.Created = append(setup.Created, name)
+			continue
+		}
+		if role.Managed {
+			setup.Problems = append(setup.Problems, fmt.Sprintf("Role %v belongs to an integration and can't be given out", name))
+		} else if highest == nil || role.Position >= highest.Position {
+			setup.Problems = append(setup.Problems, fmt.Sprintf("Role %v must be moved below the bot's highest role to be given out", name))
+		}
+	}
+	return setup, nil
 }
 
-func makeUserRuling(guildID, userID string) {
-	roleID := getRoleID(guildID, rulingRoleName)
-	userAddRole(guildID, userID, roleID)
+// guildRoles The ID of each role in the guild by name. Roles are only fetched if they aren't cached
+func (d *discord) guildRoles(guildID string) (map[string]string, error) {
+	d.rolesMu.Lock()
+	defer d.rolesMu.Unlock()
+	if roleIDs, ok := d.roleIDs[guildID]; ok {
+		return roleIDs, nil
+	}
+
+	roles, err := d.GuildRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+	roleIDs := make(map[string]string)
+	for _, v := range roles {
+		roleIDs[v.Name] = v.ID
+	}
+	d.roleIDs[guildID] = roleIDs
+	return roleIDs, nil
 }
 
-func makeUserNotRuling(guildID, userID string) {
-	roleID := getRoleID(guildID, rulingRoleName)
-	userRemoveRole(guildID, userID, roleID)
+// forgetRoles Drop the cached roles of the guild, so they are fetched again next time
+func (d *discord) forgetRoles(guildID string) {
+	d.rolesMu.Lock()
+	defer d.rolesMu.Unlock()
+	delete(d.roleIDs, guildID)
 }
 
-func userAddRole(serverID, userID, roleID string) {
-	session.GuildMemberRoleAdd(serverID, userID, roleID)
+func (d *discord) getRoleID(guildID, roleName string) (string, error) {
+	roleIDs, err := d.guildRoles(guildID)
+	if err != nil {
+		return "", err
+	}
+	roleID, ok := roleIDs[roleName]
+	if !ok {
+		return "", fmt.Errorf("Server %v has no role named %v", guildID, roleName)
+	}
+	return roleID, nil
 }
 
-func userRemoveRole(serverID, userID, roleID string) {
-	session.GuildMemberRoleRemove(serverID, userID, roleID)
+// roleNames The names of the roles with the given IDs in the guild
+func (d *discord) roleNames(guildID string, roleIDs []string) ([]string, error) {
+	guildRoles, err := d.guildRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for k, v := range guildRoles {
+		names[v] = k
+	}
+	var roleNames []string
+	for _, v := range roleIDs {
+		if name, ok := names[v]; ok {
+			roleNames = append(roleNames, name)
+		}
+	}
+	return roleNames, nil
 }
 
 func createMessage(message *discordgo.Message) *types.Message {
@@ -248,8 +456,16 @@ func createMessage(message *discordgo.Message) *types.Message {
 
 	msg.Mentions = getMentionedUsers(message, msg)
 
-	msg.Content, _ = message.ContentWithMoreMentionsReplaced(session.Session)
-	msg.Time, _ = message.Timestamp.Parse()
+	// Mentions of the bot at the start are removed before the others are replaced with names. Commands keep users
+	// mentioned by ID, since names can be out of date or have spaces, so their arguments find the right user
+	content := *message
+	content.Content, msg.Addressed = types.TrimMention(message.Content, "<@"+session.State.User.ID+">", "<@!"+session.State.User.ID+">")
+	if msg.Addressed || strings.HasPrefix(content.Content, commands.Prefix(channel.Server)) {
+		msg.Content = strings.Replace(content.Content, "<@!", "<@", -1)
+	} else {
+		msg.Content, _ = content.ContentWithMoreMentionsReplaced(session.Session)
+	}
+	msg.Time = message.Timestamp
 	msg.ID = message.ID
 
 	msg.APIID = discordName
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// discordRunName The subcommand that runs a command which also has other subcommands.
+	// Discord doesn't let a slash command take arguments and have subcommands
+	discordRunName = "run"
+	// discordMaxDescription The longest description of a slash command or option
+	discordMaxDescription = 100
+	// discordMaxChoices The most choices an option can have
+	discordMaxChoices = 25
+	// discordInteractionLifetime How long replies can be sent to an interaction
+	discordInteractionLifetime = 15 * time.Minute
+	// discordInteractionWait How long an interaction shows the bot is thinking before giving up on a reply
+	discordInteractionWait = 10 * time.Second
+	// discordPagePrefix Starts the custom ID of a button that turns the page. The command showing the page follows it
+	discordPagePrefix = "page "
+	// discordMaxCustomID The longest custom ID a button can have
+	discordMaxCustomID = 100
+)
+
+// discordNamePattern What the names of slash commands and their options can be
+var discordNamePattern = regexp.MustCompile(`^[-_a-z0-9]{1,32}$`)
+
+// discordInteraction A slash command that replies are sent to
+type discordInteraction struct {
+	*discordgo.Interaction
+	// replied Whether the first reply has replaced the bot thinking
+	replied bool
+	// update Whether the interaction is a button on one of the bot's messages, which a page reply replaces
+	update bool
+}
+
+// registerCommands Replace the bot's slash commands with every command it has
+func (d *discord) registerCommands(appID string) {
+	if _, err := d.ApplicationCommandBulkOverwrite(appID, "", discordCommands()); err != nil {
+		logging.Err(err)
+	}
+}
+
+// discordCommands Every command as a slash command. The arguments of a command become its options.
+// If a command has subcommands and runs something itself, that is done by its "run" subcommand
+func discordCommands() []*discordgo.ApplicationCommand {
+	all := commands.Commands()
+	var keys []string
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var slashCommands []*discordgo.ApplicationCommand
+	for _, name := range keys {
+		cmd := all[name]
+		if !discordNamePattern.MatchString(name) {
+			logging.Log(fmt.Sprintf("Command %v can't be a slash command", name))
+			continue
+		}
+		slashCommand := &discordgo.ApplicationCommand{Name: name, Description: discordDescription(cmd.Help, name)}
+		if len(cmd.Subcommands) == 0 {
+			slashCommand.Options = discordOptions(cmd.Args)
+			slashCommands = append(slashCommands, slashCommand)
+			continue
+		}
+
+		if cmd.Function != nil {
+			slashCommand.Options = append(slashCommand.Options, &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        discordRunName,
+				Description: discordDescription(cmd.Help, name),
+				Options:     discordOptions(cmd.Args),
+			})
+		}
+		var subKeys []string
+		for k := range cmd.Subcommands {
+			subKeys = append(subKeys, k)
+		}
+		sort.Strings(subKeys)
+		for _, k := range subKeys {
+			sub := cmd.Subcommands[k]
+			// Deeper subcommands would need subcommand groups, no command has them
+			if !discordNamePattern.MatchString(k) || k == discordRunName || len(sub.Subcommands) > 0 {
+				logging.Log(fmt.Sprintf("Command %v %v can't be a slash command", name, k))
+				continue
+			}
+			slashCommand.Options = append(slashCommand.Options, &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        k,
+				Description: discordDescription(sub.Help, name+" "+k),
+				Options:     discordOptions(sub.Args),
+			})
+		}
+		slashCommands = append(slashCommands, slashCommand)
+	}
+	return slashCommands
+}
+
+// discordOptions The options of a slash command that takes the arguments
+func discordOptions(args []commands.Arg) []*discordgo.ApplicationCommandOption {
+	var options []*discordgo.ApplicationCommandOption
+	for _, v := range args {
+		option := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        discordOptionName(v.Name),
+			Description: discordDescription(v.String(), v.Name),
+			Required:    !v.Optional && !v.Named,
+		}
+		switch v.Type {
+		case commands.ArgInt:
+			option.Type = discordgo.ApplicationCommandOptionInteger
+		case commands.ArgUser:
+			option.Type = discordgo.ApplicationCommandOptionUser
+		case commands.ArgEnum:
+			for k, choice := range v.Choices {
+				if k == discordMaxChoices {
+					break
+				}
+				option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+			}
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+// discordOptionName Options can't have spaces or capitals in their names
+func discordOptionName(name string) string {
+	return strings.Replace(strings.ToLower(name), " ", "-", -1)
+}
+
+// discordDescription Descriptions can't be empty or longer than 100 characters
+func discordDescription(description, fallback string) string {
+	if description == "" {
+		description = fallback
+	}
+	if r := []rune(description); len(r) > discordMaxDescription {
+		description = string(r[:discordMaxDescription-3]) + "..."
+	}
+	return description
+}
+
+func ready(s *discordgo.Session, r *discordgo.Ready) {
+	session.registerCommands(r.User.ID)
+}
+
+// interactionCreate Slash commands are written out as text commands and handled the same way.
+// Discord is told the bot is thinking until the first reply is sent. Page buttons run the command for their page,
+// which then replaces the message the button is on
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var response discordgo.InteractionResponseType
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		response = discordgo.InteractionResponseDeferredChannelMessageWithSource
+	case discordgo.InteractionMessageComponent:
+		if !strings.HasPrefix(i.MessageComponentData().CustomID, discordPagePrefix) {
+			return
+		}
+		response = discordgo.InteractionResponseDeferredMessageUpdate
+	default:
+		return
+	}
+	discordUser := i.User
+	if i.Member != nil {
+		discordUser = i.Member.User
+	}
+	if discordUser == nil || discordUser.Bot {
+		return
+	}
+
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: response})
+	if err != nil {
+		logging.Err(err)
+		return
+	}
+	session.addInteraction(i.Interaction)
+
+	var msg *types.Message
+	if i.Type == discordgo.InteractionMessageComponent {
+		msg = newInteractionMessage(i.Interaction, discordUser)
+		msg.Content = strings.TrimPrefix(i.MessageComponentData().CustomID, discordPagePrefix)
+	} else {
+		msg = createInteractionMessage(i.Interaction, discordUser)
+	}
+	session.dispatcher.Dispatch(events.MessageCreated{Message: msg})
+}
+
+// newInteractionMessage A message addressed to the bot from the user of the interaction, without any content
+func newInteractionMessage(i *discordgo.Interaction, discordUser *discordgo.User) *types.Message {
+	msg := new(types.Message)
+
+	author := getUser(discordUser)
+	msg.Author = author
+	msg.UserKey = author.Key
+
+	channel := getChannel(i.ChannelID)
+	msg.Channel = channel
+	msg.ChannelKey = channel.Key
+
+	msg.Addressed = true
+	msg.Time = time.Now()
+	msg.ID = i.ID
+
+	msg.APIID = discordName
+
+	return msg
+}
+
+// createInteractionMessage A message addressed to the bot with the slash command written as a text command
+func createInteractionMessage(i *discordgo.Interaction, discordUser *discordgo.User) *types.Message {
+	msg := newInteractionMessage(i, discordUser)
+
+	data := i.ApplicationCommandData()
+	names := []string{data.Name}
+	options := data.Options
+	for len(options) == 1 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		if options[0].Name != discordRunName {
+			names = append(names, options[0].Name)
+		}
+		options = options[0].Options
+	}
+	byName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, v := range options {
+		byName[v.Name] = v
+	}
+
+	msg.Content = commands.CommandText(names, func(arg commands.Arg) (string, bool) {
+		option, ok := byName[discordOptionName(arg.Name)]
+		if !ok {
+			return "", false
+		}
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionInteger:
+			return strconv.FormatInt(option.IntValue(), 10), true
+		case discordgo.ApplicationCommandOptionUser:
+			// Users are given as mentions by ID, the same way they are in commands sent as messages
+			var mentioned *discordgo.User
+			if data.Resolved != nil {
+				mentioned = data.Resolved.Users[fmt.Sprint(option.Value)]
+			}
+			if mentioned == nil {
+				return "", false
+			}
+			user := getUser(mentioned)
+			msg.Mentions = append(msg.Mentions, user)
+			return "<@" + user.ID + ">", true
+		}
+		return fmt.Sprint(option.Value), true
+	})
+	return msg
+}
+
+// addInteraction Keep the interaction until replies can't be sent to it anymore. If nothing has replied to a slash
+// command after a while, the bot stops thinking and any later replies are sent as new messages
+func (d *discord) addInteraction(i *discordgo.Interaction) {
+	update := i.Type == discordgo.InteractionMessageComponent
+	d.interactionsMu.Lock()
+	d.interactions[i.ID] = &discordInteraction{Interaction: i, update: update}
+	d.interactionsMu.Unlock()
+
+	time.AfterFunc(discordInteractionWait, func() {
+		d.interactionsMu.Lock()
+		interaction, ok := d.interactions[i.ID]
+		replied := ok && interaction.replied
+		if ok {
+			interaction.replied = true
+		}
+		d.interactionsMu.Unlock()
+		// The message a button is on stays as it was
+		if ok && !replied && !update {
+			if err := d.InteractionResponseDelete(d.State.User.ID, i); err != nil {
+				logging.Err(err)
+			}
+		}
+	})
+	time.AfterFunc(discordInteractionLifetime, func() {
+		d.interactionsMu.Lock()
+		delete(d.interactions, i.ID)
+		d.interactionsMu.Unlock()
+	})
+}
+
+// replyToInteraction Send the reply to the slash command or button the message came from. Returns false if the message
+// wasn't from an interaction, or replies can't be sent to it anymore. Only another page replaces the message a button
+// is on, anything else is sent after it
+func (d *discord) replyToInteraction(reply *types.Reply, message *types.Message) (bool, error) {
+	d.interactionsMu.Lock()
+	interaction, ok := d.interactions[message.ID]
+	first := ok && !interaction.replied && (!interaction.update || reply.Paging != nil)
+	if ok {
+		interaction.replied = true
+	}
+	d.interactionsMu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	var parts []*discordgo.WebhookParams
+	if reply.IsText() {
+		for _, v := range types.SplitMessage(reply.Text, d.MaxMessageLength()) {
+			parts = append(parts, &discordgo.WebhookParams{Content: v})
+		}
+	} else {
+		for _, v := range discordEmbeds(reply) {
+			parts = append(parts, &discordgo.WebhookParams{Embeds: []*discordgo.MessageEmbed{v}})
+		}
+	}
+	if len(parts) > 0 {
+		parts[len(parts)-1].Components = discordComponents(reply.Paging)
+	}
+
+	appID := d.State.User.ID
+	for k, v := range parts {
+		var err error
+		if k == 0 && first {
+			_, err = d.InteractionResponseEdit(appID, interaction.Interaction, &discordgo.WebhookEdit{Content: v.Content, Embeds: v.Embeds, Components: v.Components})
+		} else {
+			_, err = d.FollowupMessageCreate(appID, interaction.Interaction, true, v)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// discordComponents Previous and next buttons for a page of a reply. Each button's custom ID is the command showing its
+// page, and a button with no page is disabled. There are no buttons if the reply isn't paged, or a command is too long
+func discordComponents(paging *types.Paging) []discordgo.MessageComponent {
+	if paging == nil {
+		return nil
+	}
+	var buttons []discordgo.MessageComponent
+	for _, v := range []struct{ label, command string }{{"Previous", paging.Previous}, {"Next", paging.Next}} {
+		button := discordgo.Button{Label: v.label, Style: discordgo.SecondaryButton, CustomID: discordPagePrefix + v.command}
+		if v.command == "" {
+			// Custom IDs have to be unique in a message even if the button can't be pressed
+			button.CustomID = "no " + strings.ToLower(v.label)
+			button.Disabled = true
+		}
+		if len(button.CustomID) > discordMaxCustomID {
+			return nil
+		}
+		buttons = append(buttons, button)
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDiscordCommands(t *testing.T) {
+	slashCommands := make(map[string]*discordgo.ApplicationCommand)
+	for _, v := range discordCommands() {
+		if !discordNamePattern.MatchString(v.Name) || v.Description == "" || len([]rune(v.Description)) > discordMaxDescription {
+			t.Errorf("Invalid slash command %v: %q", v.Name, v.Description)
+		}
+		slashCommands[v.Name] = v
+		checkOptionOrder(t, v.Name, v.Options)
+	}
+
+	stats := slashCommands["stats"]
+	if stats == nil || len(stats.Options) != 3 || stats.Options[0].Required || len(stats.Options[0].Choices) != 3 ||
+		stats.Options[1].Name != "page" || stats.Options[1].Type != discordgo.ApplicationCommandOptionInteger || stats.Options[1].Required {
+		t.Fatalf("Arguments were not made into options: %+v", stats)
+	}
+
+	// Commands that take arguments and have subcommands run themselves with "run"
+	prefix := slashCommands["prefix"]
+	options := make(map[string]*discordgo.ApplicationCommandOption)
+	for _, v := range prefix.Options {
+		if v.Type != discordgo.ApplicationCommandOptionSubCommand {
+			t.Errorf("Option %v of prefix is not a subcommand", v.Name)
+		}
+		options[v.Name] = v
+	}
+	if run := options[discordRunName]; run == nil || len(run.Options) != 1 || run.Options[0].Name != "new-prefix" {
+		t.Errorf("Prefix can't be run with its arguments: %+v", run)
+	}
+	if options["reset"] == nil {
+		t.Error("Prefix is missing its subcommand")
+	}
+
+	for _, v := range slashCommands["tiers"].Options {
+		if v.Name == "move" && (len(v.Options) != 2 || v.Options[0].Type != discordgo.ApplicationCommandOptionInteger) {
+			t.Errorf("Unexpected options for tiers move: %+v", v.Options)
+		}
+	}
+
+	values := map[string]string{"name": "Top Two", "rule": "top", "limit": "2"}
+	text := commands.CommandText([]string{"tiers", "add"}, func(arg commands.Arg) (string, bool) {
+		v, ok := values[arg.Name]
+		return v, ok
+	})
+	if text != `tiers add "Top Two" top 2` {
+		t.Errorf("Slash command written as %q", text)
+	}
+
+	// Pages get a button for each way that there is a page to go
+	components := discordComponents(&types.Paging{Page: 1, Pages: 2, Next: "stats page 2"})
+	if len(components) != 1 {
+		t.Fatalf("Expected one row of buttons, got %+v", components)
+	}
+	buttons := components[0].(discordgo.ActionsRow).Components
+	if len(buttons) != 2 || !buttons[0].(discordgo.Button).Disabled || buttons[1].(discordgo.Button).CustomID != "page stats page 2" {
+		t.Errorf("Unexpected page buttons: %+v", buttons)
+	}
+	if discordComponents(nil) != nil || discordComponents(&types.Paging{Next: strings.Repeat("x", 100)}) != nil {
+		t.Error("Buttons made for a reply that can't be paged")
+	}
+}
+
+// checkOptionOrder Discord rejects every command if any of them has a required option after an optional one
+func checkOptionOrder(t *testing.T, name string, options []*discordgo.ApplicationCommandOption) {
+	optional := false
+	for _, v := range options {
+		if v.Type == discordgo.ApplicationCommandOptionSubCommand {
+			checkOptionOrder(t, name+" "+v.Name, v.Options)
+			continue
+		}
+		if v.Required && optional {
+			t.Errorf("Required option %v of %v comes after an optional one", v.Name, name)
+		}
+		optional = optional || !v.Required
+	}
+}
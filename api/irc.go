@@ -0,0 +1,546 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+type irc struct {
+	address   string
+	nick      string
+	password  string
+	channels  []string
+	conn      net.Conn
+	writeLock sync.Mutex
+	names     map[string]map[string]bool
+	// hosts The user@host of every nick seen. Unlike the nick, the host can't be taken by someone else
+	hosts map[string]string
+	// accounts The services account of every nick whose last message was sent while logged in to one
+	accounts map[string]string
+	// ops The permission of every nick with channel modes that give them one, by channel
+	ops map[string]map[string]ircOp
+	// runID Starts every message ID so they don't collide with the ones stored by earlier runs
+	runID      string
+	messageNum int
+	dispatcher *events.Dispatcher
+	done       chan struct{}
+}
+
+const ircName = "irc"
+
+// ircMaxLength IRC lines are at most 512 bytes, which includes the command and the prefix added by the server
+const ircMaxLength = 400
+
+// ircSeparator Separates the network from the channel or nick in stored IDs. IRC names can never contain a space
+const ircSeparator = " "
+
+func (i *irc) String() string {
+	return ircName
+}
+
+var _ types.API = (*irc)(nil)
+var _ types.PermissionAPI = (*irc)(nil)
+var _ types.IdentityAPI = (*irc)(nil)
+
+// ircOp A permission given to a nick, and the host it was given to. It only counts while the nick has that host
+type ircOp struct {
+	permission types.Permission
+	host       string
+}
+
+// ircPrefixPermissions The permission given by each nick prefix in a NAMES reply
+var ircPrefixPermissions = map[byte]types.Permission{
+	'~': types.ServerAdmin,
+	'&': types.ServerAdmin,
+	'@': types.ServerAdmin,
+	'%': types.Moderator,
+}
+
+// ircModePermissions The permission given by each channel mode set on a nick
+var ircModePermissions = map[byte]types.Permission{
+	'q': types.ServerAdmin,
+	'a': types.ServerAdmin,
+	'o': types.ServerAdmin,
+	'h': types.Moderator,
+}
+
+// NewIRC Create an API that connects to the IRC network at address (host:port) as nick and joins the given channels
+func NewIRC(address, nick, password string, channels []string) (types.API, error) {
+	if address == "" {
+		return nil, fmt.Errorf("You must provide an IRC server address (-ircserver)")
+	}
+	if nick == "" {
+		return nil, fmt.Errorf("You must provide an IRC nick (-ircnick)")
+	}
+	i := new(irc)
+	i.address = address
+	i.nick = nick
+	i.password = password
+	i.channels = channels
+	i.names = make(map[string]map[string]bool)
+	i.hosts = make(map[string]string)
+	i.accounts = make(map[string]string)
+	i.ops = make(map[string]map[string]ircOp)
+	i.runID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	i.dispatcher = events.NewDispatcher(i)
+	i.done = make(chan struct{})
+	return i, nil
+}
+
+func (i *irc) Setup() error {
+	logging.Log("Setting up respecbot on irc")
+	var err error
+	i.conn, err = net.Dial("tcp", i.address)
+	if err != nil {
+		logging.Log("error opening connection,", err.Error())
+		return err
+	}
+
+	// Messages are tagged with the sender's services account on networks that support it
+	i.send("CAP", "REQ", "account-tag")
+	if i.password != "" {
+		i.send("PASS", i.password)
+	}
+	i.send("NICK", i.nick)
+	i.send("USER", i.nick, "0", "*", "respecbot")
+	return i.send("CAP", "END")
+}
+
+func (i *irc) Listen() error {
+	logging.Log("IRC api listening")
+	err := i.read()
+	select {
+	case <-i.done:
+		// Reading fails once the connection is closed on purpose
+		return nil
+	default:
+		return err
+	}
+}
+
+func (i *irc) Close() error {
+	close(i.done)
+	i.send("QUIT", "RESPEC")
+	return i.conn.Close()
+}
+
+// ReplyTo IRC messages cannot contain newlines, so every line of the reply is sent separately
+func (i *irc) ReplyTo(reply *types.Reply, message *types.Message) error {
+	_, target := splitIRCID(message.Channel.ID)
+	for _, line := range strings.Split(reply.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		for _, v := range types.SplitMessage(line, i.MaxMessageLength()) {
+			if err := i.send("PRIVMSG", target, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *irc) MaxMessageLength() int {
+	return ircMaxLength
+}
+
+func (i *irc) HandleCommand(message *types.Message) error {
+	commands.HandleCommand(i, message)
+	return nil
+}
+
+func (i *irc) GetUser(userID string) *types.User {
+	return db.GetUser(userID, ircName)
+}
+
+func (i *irc) GetChannel(channelID string) *types.Channel {
+	return db.GetChannel(channelID, ircName)
+}
+
+func (i *irc) GetServer(serverID string) *types.Server {
+	return db.GetServer(serverID, ircName)
+}
+
+// send Write a single IRC command. The last parameter is always sent as a trailing parameter
+func (i *irc) send(command string, params ...string) error {
+	line := command
+	for k, v := range params {
+		if k == len(params)-1 {
+			line += " :" + v
+		} else {
+			line += " " + v
+		}
+	}
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+	_, err := fmt.Fprintf(i.conn, "%v\r\n", line)
+	return err
+}
+
+// read Handle every line sent by the server until the connection is closed
+func (i *irc) read() error {
+	scanner := bufio.NewScanner(i.conn)
+	for scanner.Scan() {
+		tags, line := splitIRCTags(scanner.Text())
+		prefix, command, params := parseIRCLine(line)
+		i.handle(tags, prefix, command, params)
+	}
+	return scanner.Err()
+}
+
+func (i *irc) handle(tags map[string]string, prefix, command string, params []string) {
+	nick := strings.SplitN(prefix, "!", 2)[0]
+	if host := ircHost(prefix); host != "" {
+		i.hosts[strings.ToLower(nick)] = host
+	}
+	switch command {
+	case "PING":
+		i.send("PONG", params...)
+	case "001":
+		// Registered with the network, the nick may have been changed by the server
+		if len(params) > 0 {
+			i.nick = params[0]
+		}
+		for _, v := range i.channels {
+			i.send("JOIN", v)
+			// The hosts of everyone already in the channel, and their modes again now that the hosts are known
+			i.send("WHO", v)
+		}
+		i.dispatcher.Dispatch(events.ServerJoined{Server: i.getServer()})
+	case "353":
+		// RPL_NAMREPLY: <me> <type> <channel> :<nicks>
+		if len(params) < 4 {
+			return
+		}
+		for _, v := range strings.Fields(params[3]) {
+			nick := strings.TrimLeft(v, "~&@%+")
+			i.addName(params[2], nick)
+			if permission, ok := ircPrefixPermissions[v[0]]; ok {
+				i.setOp(params[2], nick, permission)
+			}
+		}
+	case "352":
+		// RPL_WHOREPLY: <me> <channel> <user> <host> <server> <nick> <flags> :<hops> <realname>
+		if len(params) < 7 {
+			return
+		}
+		i.hosts[strings.ToLower(params[5])] = strings.ToLower(params[2] + "@" + params[3])
+		for _, v := range []byte(params[6]) {
+			if permission, ok := ircPrefixPermissions[v]; ok {
+				i.setOp(params[1], params[5], permission)
+				break
+			}
+		}
+	case "MODE":
+		if len(params) < 2 || !strings.HasPrefix(params[0], "#") {
+			return
+		}
+		i.handleChannelMode(params[0], params[1], params[2:])
+	case "JOIN":
+		if len(params) < 1 {
+			return
+		}
+		i.addName(params[0], nick)
+		if !strings.EqualFold(nick, i.nick) {
+			i.dispatcher.Dispatch(events.MemberJoined{User: i.getUser(nick), Server: i.getServer()})
+		}
+	case "PART", "KICK":
+		if len(params) < 1 {
+			return
+		}
+		if command == "KICK" && len(params) > 1 {
+			nick = params[1]
+		}
+		delete(i.names[strings.ToLower(params[0])], strings.ToLower(nick))
+		delete(i.ops[strings.ToLower(params[0])], strings.ToLower(nick))
+	case "QUIT":
+		delete(i.hosts, strings.ToLower(nick))
+		delete(i.accounts, strings.ToLower(nick))
+		for _, v := range i.names {
+			delete(v, strings.ToLower(nick))
+		}
+		for _, v := range i.ops {
+			delete(v, strings.ToLower(nick))
+		}
+	case "NICK":
+		if len(params) < 1 {
+			return
+		}
+		for _, v := range i.names {
+			if v[strings.ToLower(nick)] {
+				delete(v, strings.ToLower(nick))
+				v[strings.ToLower(params[0])] = true
+			}
+		}
+		for _, v := range i.ops {
+			if op, ok := v[strings.ToLower(nick)]; ok {
+				delete(v, strings.ToLower(nick))
+				v[strings.ToLower(params[0])] = op
+			}
+		}
+		if host, ok := i.hosts[strings.ToLower(nick)]; ok {
+			delete(i.hosts, strings.ToLower(nick))
+			i.hosts[strings.ToLower(params[0])] = host
+		}
+		if account, ok := i.accounts[strings.ToLower(nick)]; ok {
+			delete(i.accounts, strings.ToLower(nick))
+			i.accounts[strings.ToLower(params[0])] = account
+		}
+		if strings.EqualFold(nick, i.nick) {
+			i.nick = params[0]
+		}
+	case "PRIVMSG":
+		// Only messages sent to a channel are rated, private messages have no server
+		if len(params) < 2 || strings.EqualFold(nick, i.nick) || !strings.HasPrefix(params[0], "#") {
+			return
+		}
+		if account := tags["account"]; account != "" {
+			i.accounts[strings.ToLower(nick)] = strings.ToLower(account)
+		} else {
+			delete(i.accounts, strings.ToLower(nick))
+		}
+		msg := i.createMessage(nick, params[0], params[1])
+		i.dispatcher.Dispatch(events.MessageCreated{Message: msg})
+	}
+}
+
+func (i *irc) addName(channel, nick string) {
+	channel = strings.ToLower(channel)
+	if i.names[channel] == nil {
+		i.names[channel] = make(map[string]bool)
+	}
+	i.names[channel][strings.ToLower(nick)] = true
+}
+
+// setOp Give the nick a permission in the channel, tied to the host the nick has now
+func (i *irc) setOp(channel, nick string, permission types.Permission) {
+	channel = strings.ToLower(channel)
+	nick = strings.ToLower(nick)
+	if i.ops[channel] == nil {
+		i.ops[channel] = make(map[string]ircOp)
+	}
+	if permission == types.Everyone {
+		delete(i.ops[channel], nick)
+		return
+	}
+	i.ops[channel][nick] = ircOp{permission: permission, host: i.hosts[nick]}
+}
+
+// handleChannelMode Track modes that give nicks a permission. Taking one away leaves the nick with no permission,
+// even if they still have another mode, until the next NAMES reply
+func (i *irc) handleChannelMode(channel, modes string, args []string) {
+	adding := true
+	for k := 0; k < len(modes); k++ {
+		mode := modes[k]
+		switch {
+		case mode == '+' || mode == '-':
+			adding = mode == '+'
+			continue
+		case strings.IndexByte("qaohvbeIk", mode) >= 0 || (mode == 'l' && adding):
+			// These modes take an argument
+		default:
+			continue
+		}
+		if len(args) == 0 {
+			return
+		}
+		arg := args[0]
+		args = args[1:]
+		if permission, ok := ircModePermissions[mode]; ok {
+			if !adding {
+				permission = types.Everyone
+			}
+			i.setOp(channel, arg, permission)
+		}
+	}
+}
+
+// UserPermission Channel operators are admins and half-operators are moderators, as long as they still have the host
+// they had when they were given the mode. Anyone else who takes their nick gets nothing
+func (i *irc) UserPermission(channel *types.Channel, user *types.User) (types.Permission, error) {
+	_, channelName := splitIRCID(channel.ID)
+	_, nick := splitIRCID(user.ID)
+	op, ok := i.ops[strings.ToLower(channelName)][nick]
+	if !ok || op.host == "" || op.host != i.hosts[nick] {
+		return types.Everyone, nil
+	}
+	return op.permission, nil
+}
+
+// Identity Users are who their services account says they are, or their user@host if they aren't logged in to one
+func (i *irc) Identity(user *types.User) (string, bool) {
+	_, nick := splitIRCID(user.ID)
+	if account, ok := i.accounts[nick]; ok {
+		return "$a:" + account, true
+	}
+	host, ok := i.hosts[nick]
+	return host, ok
+}
+
+func (i *irc) createMessage(nick, channelName, content string) *types.Message {
+	msg := new(types.Message)
+
+	author := i.getUser(nick)
+	msg.Author = author
+	msg.UserKey = author.Key
+
+	channel := i.getChannel(channelName)
+	msg.Channel = channel
+	msg.ChannelKey = channel.Key
+
+	content, msg.Addressed = types.TrimMention(content, i.nick)
+	msg.Mentions = i.getMentionedUsers(channelName, content)
+
+	i.messageNum++
+	msg.Content = content
+	msg.Time = time.Now()
+	msg.ID = i.runID + "-" + strconv.Itoa(i.messageNum)
+
+	msg.APIID = ircName
+
+	return msg
+}
+
+// getMentionedUsers Any word that is the nick of someone in the channel highlights them
+func (i *irc) getMentionedUsers(channelName, content string) []*types.User {
+	var users []*types.User
+	names := i.names[strings.ToLower(channelName)]
+	seen := make(map[string]bool)
+
+	for _, v := range strings.Fields(content) {
+		nick := strings.Trim(v, ":,.!?;@")
+		lower := strings.ToLower(nick)
+		if !names[lower] || seen[lower] || lower == strings.ToLower(i.nick) {
+			continue
+		}
+		seen[lower] = true
+		users = append(users, i.getUser(nick))
+	}
+
+	return users
+}
+
+func (i *irc) getUser(nick string) *types.User {
+	userID := i.address + ircSeparator + strings.ToLower(nick)
+	user := db.GetUser(userID, ircName)
+	if user == nil {
+		user = new(types.User)
+		user.ID = userID
+		user.Name = nick
+		user.APIID = ircName
+		db.NewUser(user)
+	}
+	return user
+}
+
+func (i *irc) getChannel(channelName string) *types.Channel {
+	channelID := i.address + ircSeparator + strings.ToLower(channelName)
+	channel := db.GetChannel(channelID, ircName)
+	if channel == nil {
+		channel = new(types.Channel)
+		channel.ID = channelID
+		channel.Server = i.getServer()
+		channel.ServerKey = channel.Server.Key
+		channel.APIID = ircName
+		channel.Active = false
+		db.NewChannel(channel)
+	}
+	return channel
+}
+
+// getServer The network the bot is connected to is the only server
+func (i *irc) getServer() *types.Server {
+	server := db.GetServer(i.address, ircName)
+	if server == nil {
+		server = new(types.Server)
+		server.ID = i.address
+		server.APIID = ircName
+		db.NewServer(server)
+	}
+	return server
+}
+
+// splitIRCID Split a stored channel or user ID into the network and the IRC name
+func splitIRCID(id string) (network, name string) {
+	s := strings.SplitN(id, ircSeparator, 2)
+	if len(s) < 2 {
+		return "", id
+	}
+	return s[0], s[1]
+}
+
+// ircHost The lower case user@host of a message prefix, or "" if the prefix is a server
+func ircHost(prefix string) string {
+	s := strings.SplitN(prefix, "!", 2)
+	if len(s) < 2 || !strings.Contains(s[1], "@") {
+		return ""
+	}
+	return strings.ToLower(s[1])
+}
+
+// splitIRCTags Split the IRCv3 message tags from the start of a raw IRC line
+func splitIRCTags(line string) (tags map[string]string, rest string) {
+	tags = make(map[string]string)
+	if !strings.HasPrefix(line, "@") {
+		return tags, line
+	}
+	s := strings.SplitN(line[1:], " ", 2)
+	for _, v := range strings.Split(s[0], ";") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	if len(s) < 2 {
+		return tags, ""
+	}
+	return tags, s[1]
+}
+
+// parseIRCLine Split a raw IRC line into its prefix, command, and parameters
+func parseIRCLine(line string) (prefix, command string, params []string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, ":") {
+		s := strings.SplitN(line[1:], " ", 2)
+		prefix = s[0]
+		if len(s) < 2 {
+			return
+		}
+		line = s[1]
+	}
+
+	var trailing string
+	hasTrailing := false
+	if k := strings.Index(line, " :"); k >= 0 {
+		trailing = line[k+2:]
+		hasTrailing = true
+		line = line[:k]
+	} else if strings.HasPrefix(line, ":") {
+		trailing = line[1:]
+		hasTrailing = true
+		line = ""
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		command = strings.ToUpper(fields[0])
+		params = fields[1:]
+	}
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+)
+
+// ircStub One connection to a fake IRC server
+type ircStub struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *ircStub) send(line string) {
+	if _, err := s.conn.Write([]byte(line + "\r\n")); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// expect Read lines until one starts with the given prefix
+func (s *ircStub) expect(prefix string) string {
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			s.t.Fatalf("Expected %q, got error %v", prefix, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+func TestIRC(t *testing.T) {
+	if err := db.Setup("irctest.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteDB("irctest.db")
+	defer db.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	a, err := NewIRC(ln.Addr().String(), "respecbot", "", []string{"#respec"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("No connection accepted")
+	}
+	stub := &ircStub{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- a.Listen()
+	}()
+
+	stub.expect("CAP REQ :account-tag")
+	stub.expect("NICK :respecbot")
+	stub.expect("USER respecbot 0 * :respecbot")
+	stub.expect("CAP :END")
+	stub.send(":irc.test 001 respecbot :Welcome")
+	stub.expect("JOIN :#respec")
+	stub.send(":irc.test 353 respecbot = #respec :respecbot @alice +bob")
+	stub.expect("WHO :#respec")
+	stub.send(":irc.test 352 respecbot #respec a host irc.test alice H@ :0 Alice")
+	stub.send(":irc.test 352 respecbot #respec b host irc.test bob H+ :0 Bob")
+
+	stub.send("PING :irc.test")
+	stub.expect("PONG :irc.test")
+
+	stub.send(":alice!a@host PRIVMSG #respec :%lookatme")
+	stub.expect("PRIVMSG #respec :Fuck on me")
+
+	stub.send(":alice!a@host PRIVMSG #respec :bob: Hello there, how are you doing today?")
+	// Commands are handled in order, so the reply means the previous message was rated
+	stub.send(":alice!a@host PRIVMSG #respec :%version")
+	stub.expect("PRIVMSG #respec :Version")
+
+	bob := a.GetUser(ln.Addr().String() + " bob")
+	channel := a.GetChannel(ln.Addr().String() + " #respec")
+	if bob == nil || channel == nil {
+		t.Fatal("Highlighted user or channel not stored")
+	}
+	if respec := db.GetUserLocalRespec(bob, channel); respec != 3 {
+		t.Errorf("Highlight not respected. Expected %v, got %v", 3, respec)
+	}
+	// Message IDs start with the run so they don't collide with the ones stored by earlier runs
+	alice := a.GetUser(ln.Addr().String() + " alice")
+	if last := db.GetLastMessage(alice, channel); last == nil || last.ID != a.(*irc).runID+"-2" {
+		t.Errorf("Unexpected message ID %+v", last)
+	}
+
+	// Only operators can turn the bot off, and giving bob half-operator lets him
+	stub.send(":bob!b@host PRIVMSG #respec :%fuckoff")
+	stub.expect("PRIVMSG #respec :You need to be a moderator to use `fuckoff`")
+	stub.send(":alice!a@host MODE #respec +h bob")
+	stub.send(":bob!b@host PRIVMSG #respec :%fuckoff")
+	stub.send(":bob!b@host PRIVMSG #respec :%lookatme")
+	stub.expect("PRIVMSG #respec :Fuck on me")
+
+	// Owners are matched by services account, not by nick
+	if err = commands.SetOwners([]string{"irc:$a:carol"}); err != nil {
+		t.Fatal(err)
+	}
+	stub.send(":carol!c@host PRIVMSG #respec :%alias")
+	stub.expect("PRIVMSG #respec :You need to be a server admin to use `alias`")
+	stub.send("@account=Carol :carol!c@host PRIVMSG #respec :%alias")
+	stub.expect("PRIVMSG #respec :Aliases")
+	commands.SetOwners(nil)
+
+	// Someone else with an operator's nick doesn't get their permission, even if the bot missed the operator leaving
+	stub.send(":alice!m@elsewhere PRIVMSG #respec :%fuckoff")
+	stub.expect("PRIVMSG #respec :You need to be a moderator to use `fuckoff`")
+
+	conn.Close()
+	select {
+	case err = <-listening:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Listen did not return after the connection closed")
+	}
+}
+
+func TestParseIRCLine(t *testing.T) {
+	prefix, command, params := parseIRCLine(":nick!user@host PRIVMSG #chan :hello there :)\r\n")
+	if prefix != "nick!user@host" || command != "PRIVMSG" || len(params) != 2 || params[0] != "#chan" || params[1] != "hello there :)" {
+		t.Errorf("Line not parsed correctly: %q %q %q", prefix, command, params)
+	}
+
+	tags, line := splitIRCTags("@account=alice;id=1 :alice!a@host PRIVMSG #chan :hi")
+	if tags["account"] != "alice" || tags["id"] != "1" || !strings.HasPrefix(line, ":alice!a@host") {
+		t.Errorf("Tags not split correctly: %q %q", tags, line)
+	}
+
+	prefix, command, params = parseIRCLine("PING :server")
+	if prefix != "" || command != "PING" || len(params) != 1 || params[0] != "server" {
+		t.Errorf("Line not parsed correctly: %q %q %q", prefix, command, params)
+	}
+}
@@ -0,0 +1,516 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+type matrix struct {
+	homeserver  string
+	accessToken string
+	userID      string
+	client      *http.Client
+	since       string
+	txnNum      int
+	txnLock     sync.Mutex
+	dispatcher  *events.Dispatcher
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+const matrixName = "matrix"
+
+const (
+	matrixClientPath  = "/_matrix/client/v3"
+	matrixSyncTimeout = 30 * time.Second
+	matrixRetryDelay  = 5 * time.Second
+	// matrixMaxLength Events can be 65536 bytes, leave plenty of room for everything around the body
+	matrixMaxLength = 32000
+)
+
+func (m *matrix) String() string {
+	return matrixName
+}
+
+var _ types.API = (*matrix)(nil)
+var _ types.PermissionAPI = (*matrix)(nil)
+
+// matrixEvent The parts of a room event respecbot uses
+type matrixEvent struct {
+	Type           string          `json:"type"`
+	EventID        string          `json:"event_id"`
+	Sender         string          `json:"sender"`
+	OriginServerTS int64           `json:"origin_server_ts"`
+	StateKey       *string         `json:"state_key"`
+	Redacts        string          `json:"redacts"`
+	Content        json.RawMessage `json:"content"`
+}
+
+type matrixMessageContent struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	FormattedBody string `json:"formatted_body"`
+	Mentions      struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions"`
+}
+
+type matrixReactionContent struct {
+	RelatesTo struct {
+		RelType string `json:"rel_type"`
+		EventID string `json:"event_id"`
+		Key     string `json:"key"`
+	} `json:"m.relates_to"`
+}
+
+type matrixMemberContent struct {
+	Membership string `json:"membership"`
+}
+
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// matrixError An error response from the homeserver
+type matrixError struct {
+	Status  int
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("Matrix error %v %v: %v", e.Status, e.ErrCode, e.Message)
+}
+
+// NewMatrix Create an API that connects to the Matrix homeserver at the given URL with the given access token
+func NewMatrix(homeserver, accessToken string) (types.API, error) {
+	if homeserver == "" {
+		return nil, fmt.Errorf("You must provide a Matrix homeserver URL (-matrixserver)")
+	}
+	if accessToken == "" {
+		return nil, fmt.Errorf("You must provide a Matrix access token (-matrixtoken)")
+	}
+	m := new(matrix)
+	m.homeserver = strings.TrimSuffix(homeserver, "/")
+	m.accessToken = accessToken
+	m.client = &http.Client{Timeout: matrixSyncTimeout + 30*time.Second}
+	m.dispatcher = events.NewDispatcher(m)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+func (m *matrix) Setup() error {
+	logging.Log("Setting up respecbot on matrix")
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := m.request("GET", "/account/whoami", nil, nil, &whoami); err != nil {
+		logging.Log("error opening connection,", err.Error())
+		return err
+	}
+	m.userID = whoami.UserID
+
+	// Only events sent after the bot starts are handled, so the first sync is only used to find where to start
+	var response matrixSync
+	if err := m.request("GET", "/sync", url.Values{"timeout": {"0"}}, nil, &response); err != nil {
+		return err
+	}
+	m.since = response.NextBatch
+	return nil
+}
+
+func (m *matrix) Listen() error {
+	logging.Log("Matrix api listening")
+	return m.syncLoop()
+}
+
+// Close Cancels any request in progress, including the sync Listen is waiting on
+func (m *matrix) Close() error {
+	m.cancel()
+	return nil
+}
+
+// ReplyTo Replies with more than text are also sent as HTML, unless they have to be split over several messages
+func (m *matrix) ReplyTo(reply *types.Reply, message *types.Message) error {
+	parts := types.SplitMessage(reply.String(), m.MaxMessageLength())
+	for _, v := range parts {
+		content := map[string]string{
+			"msgtype": "m.notice",
+			"body":    v,
+		}
+		if !reply.IsText() && len(parts) == 1 {
+			content["format"] = "org.matrix.custom.html"
+			content["formatted_body"] = matrixHTML(reply)
+		}
+		if err := m.send(message.Channel.ID, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *matrix) MaxMessageLength() int {
+	return matrixMaxLength
+}
+
+// send Send a message event to the room
+func (m *matrix) send(roomID string, content map[string]string) error {
+	m.txnLock.Lock()
+	m.txnNum++
+	txnID := fmt.Sprintf("respecbot%v.%v", time.Now().UnixNano(), m.txnNum)
+	m.txnLock.Unlock()
+
+	path := fmt.Sprintf("/rooms/%v/send/m.room.message/%v", url.PathEscape(roomID), url.PathEscape(txnID))
+	return m.request("PUT", path, nil, content, nil)
+}
+
+func (m *matrix) HandleCommand(message *types.Message) error {
+	commands.HandleCommand(m, message)
+	return nil
+}
+
+func (m *matrix) GetUser(userID string) *types.User {
+	return db.GetUser(userID, matrixName)
+}
+
+func (m *matrix) GetChannel(channelID string) *types.Channel {
+	return db.GetChannel(channelID, matrixName)
+}
+
+func (m *matrix) GetServer(serverID string) *types.Server {
+	return db.GetServer(serverID, matrixName)
+}
+
+// matrixPowerLevels The power levels of a room. Only the parts used to decide permissions are read
+type matrixPowerLevels struct {
+	Users        map[string]int `json:"users"`
+	UsersDefault int            `json:"users_default"`
+}
+
+// matrixModeratorLevel The power level that makes a user a moderator, the same one clients use
+const matrixModeratorLevel = 50
+
+// UserPermission Users are moderators in a room if their power level in it is high enough. A room's admins only get to
+// moderate it, since anyone can create a room on a homeserver. Server settings are left to the bot's owners
+func (m *matrix) UserPermission(channel *types.Channel, user *types.User) (types.Permission, error) {
+	var levels matrixPowerLevels
+	if err := m.request("GET", "/rooms/"+url.PathEscape(channel.ID)+"/state/m.room.power_levels/", nil, nil, &levels); err != nil {
+		return types.Everyone, err
+	}
+	level, ok := levels.Users[user.ID]
+	if !ok {
+		level = levels.UsersDefault
+	}
+	if level >= matrixModeratorLevel {
+		return types.Moderator, nil
+	}
+	return types.Everyone, nil
+}
+
+// request Make a request to the client-server API and decode the response into 'out' if it isn't nil
+func (m *matrix) request(method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	u := m.homeserver + matrixClientPath + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(m.ctx)
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := &matrixError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// syncLoop Long poll the homeserver for new events until closed or the access token stops working
+func (m *matrix) syncLoop() error {
+	for {
+		if m.ctx.Err() != nil {
+			return nil
+		}
+		var response matrixSync
+		query := url.Values{
+			"since":   {m.since},
+			"timeout": {strconv.FormatInt(int64(matrixSyncTimeout/time.Millisecond), 10)},
+		}
+		err := m.request("GET", "/sync", query, nil, &response)
+		if e, ok := err.(*matrixError); ok && (e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden) {
+			return err
+		} else if err != nil {
+			if m.ctx.Err() != nil {
+				return nil
+			}
+			logging.Err(err)
+			select {
+			case <-time.After(matrixRetryDelay):
+			case <-m.ctx.Done():
+			}
+			continue
+		}
+		m.since = response.NextBatch
+
+		for roomID := range response.Rooms.Invite {
+			m.joinRoom(roomID)
+		}
+		for roomID, room := range response.Rooms.Join {
+			for _, event := range room.Timeline.Events {
+				m.handle(roomID, event)
+			}
+		}
+	}
+}
+
+func (m *matrix) joinRoom(roomID string) {
+	if err := m.request("POST", "/rooms/"+url.PathEscape(roomID)+"/join", nil, struct{}{}, nil); err != nil {
+		logging.Err(err)
+		return
+	}
+	m.dispatcher.Dispatch(events.ServerJoined{Server: m.getServer(roomID)})
+}
+
+func (m *matrix) handle(roomID string, event matrixEvent) {
+	if event.Sender == m.userID {
+		return
+	}
+	switch event.Type {
+	case "m.room.message":
+		var content matrixMessageContent
+		if err := json.Unmarshal(event.Content, &content); err != nil || content.MsgType != "m.text" {
+			return
+		}
+		msg := m.createMessage(roomID, event, content)
+		m.dispatcher.Dispatch(events.MessageCreated{Message: msg})
+	case "m.reaction":
+		var content matrixReactionContent
+		if err := json.Unmarshal(event.Content, &content); err != nil || content.RelatesTo.RelType != "m.annotation" {
+			return
+		}
+		author := m.getEventSender(roomID, content.RelatesTo.EventID)
+		// The bot doesn't get respec for reactions to its own messages
+		if author == nil || author.ID == m.userID {
+			return
+		}
+		channel := m.getChannel(roomID)
+		// Redactions only give the ID of the reaction, so it is stored to take the respec back even after a restart
+		err := db.NewReaction(&types.Reaction{ID: event.EventID, APIID: matrixName, GiverID: event.Sender, Author: author, ChannelKey: channel.Key, Time: matrixTime(event)})
+		if err != nil {
+			logging.Err(err)
+		}
+		m.dispatcher.Dispatch(events.ReactionAdded{GiverID: event.Sender, Author: author, Channel: channel, Time: matrixTime(event)})
+	case "m.room.redaction":
+		reaction := db.TakeReaction(event.Redacts, matrixName)
+		if reaction == nil || reaction.Author == nil {
+			return
+		}
+		m.dispatcher.Dispatch(events.ReactionRemoved{GiverID: reaction.GiverID, Author: reaction.Author, Channel: m.getChannel(roomID), Time: matrixTime(event)})
+	case "m.room.member":
+		var content matrixMemberContent
+		if err := json.Unmarshal(event.Content, &content); err != nil || content.Membership != "join" || event.StateKey == nil || *event.StateKey == m.userID {
+			return
+		}
+		m.dispatcher.Dispatch(events.MemberJoined{User: m.getUser(*event.StateKey), Server: m.getServer(roomID)})
+	}
+}
+
+// matrixHTML Render a reply as the HTML subset Matrix clients support
+func matrixHTML(reply *types.Reply) string {
+	var b bytes.Buffer
+	if reply.Title != "" {
+		fmt.Fprintf(&b, "<h4>%v</h4>", html.EscapeString(reply.Title))
+	}
+	if reply.Text != "" {
+		fmt.Fprintf(&b, "<p>%v</p>", strings.Replace(html.EscapeString(reply.Text), "\n", "<br>", -1))
+	}
+	if len(reply.Table) > 0 {
+		b.WriteString("<table>")
+		for _, row := range reply.Table {
+			b.WriteString("<tr>")
+			for _, cell := range row {
+				fmt.Fprintf(&b, "<td>%v</td>", html.EscapeString(cell))
+			}
+			b.WriteString("</tr>")
+		}
+		b.WriteString("</table>")
+	}
+	if reply.Code != "" {
+		fmt.Fprintf(&b, "<pre><code>%v</code></pre>", html.EscapeString(reply.Code))
+	}
+	for _, v := range reply.Fields {
+		fmt.Fprintf(&b, "<p><b>%v</b>: %v</p>", html.EscapeString(v.Name), html.EscapeString(v.Value))
+	}
+	if reply.Image != "" {
+		fmt.Fprintf(&b, "<p>%v</p>", html.EscapeString(reply.Image))
+	}
+	if reply.Footer != "" {
+		fmt.Fprintf(&b, "<p><sub>%v</sub></p>", html.EscapeString(reply.Footer))
+	}
+	return b.String()
+}
+
+// getEventSender Get the user who sent the given event
+func (m *matrix) getEventSender(roomID, eventID string) *types.User {
+	var event matrixEvent
+	path := fmt.Sprintf("/rooms/%v/event/%v", url.PathEscape(roomID), url.PathEscape(eventID))
+	if err := m.request("GET", path, nil, nil, &event); err != nil {
+		logging.Err(err)
+		return nil
+	}
+	return m.getUser(event.Sender)
+}
+
+func (m *matrix) createMessage(roomID string, event matrixEvent, content matrixMessageContent) *types.Message {
+	msg := new(types.Message)
+
+	author := m.getUser(event.Sender)
+	msg.Author = author
+	msg.UserKey = author.Key
+
+	channel := m.getChannel(roomID)
+	msg.Channel = channel
+	msg.ChannelKey = channel.Key
+
+	msg.Mentions = m.getMentionedUsers(event.Sender, content)
+
+	// Clients start replies to someone with their name, or their ID in older clients
+	msg.Content, msg.Addressed = types.TrimMention(content.Body, m.userID, matrixLocalpart(m.userID))
+	msg.Time = matrixTime(event)
+	msg.ID = event.EventID
+
+	msg.APIID = matrixName
+
+	return msg
+}
+
+// getMentionedUsers Users are mentioned through m.mentions or with a matrix.to pill in the formatted body
+func (m *matrix) getMentionedUsers(sender string, content matrixMessageContent) []*types.User {
+	var users []*types.User
+	userMap := make(map[string]bool)
+
+	userIDs := content.Mentions.UserIDs
+	for _, v := range strings.Split(content.FormattedBody, "https://matrix.to/#/")[1:] {
+		if end := strings.IndexAny(v, "\"'?"); end > 0 {
+			if userID, err := url.PathUnescape(v[:end]); err == nil && strings.HasPrefix(userID, "@") {
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+
+	for _, v := range userIDs {
+		if userMap[v] || v == m.userID {
+			continue
+		}
+		userMap[v] = true
+		users = append(users, m.getUser(v))
+	}
+
+	return users
+}
+
+func (m *matrix) getUser(userID string) *types.User {
+	user := db.GetUser(userID, matrixName)
+	if user == nil {
+		user = new(types.User)
+		user.ID = userID
+		user.Name = matrixLocalpart(userID)
+		user.APIID = matrixName
+		db.NewUser(user)
+	}
+	return user
+}
+
+func (m *matrix) getChannel(roomID string) *types.Channel {
+	channel := db.GetChannel(roomID, matrixName)
+	if channel == nil {
+		channel = new(types.Channel)
+		channel.ID = roomID
+		channel.Server = m.getServer(roomID)
+		channel.ServerKey = channel.Server.Key
+		channel.APIID = matrixName
+		channel.Active = false
+		db.NewChannel(channel)
+	}
+	return channel
+}
+
+// getServer A room belongs to the homeserver it was created on
+func (m *matrix) getServer(roomID string) *types.Server {
+	serverID := matrixServerName(roomID)
+	server := db.GetServer(serverID, matrixName)
+	if server == nil {
+		server = new(types.Server)
+		server.ID = serverID
+		server.APIID = matrixName
+		db.NewServer(server)
+	}
+	return server
+}
+
+// matrixServerName The server name of a Matrix ID, ie "example.org" for "!room:example.org"
+func matrixServerName(id string) string {
+	s := strings.SplitN(id, ":", 2)
+	if len(s) < 2 {
+		return id
+	}
+	return s[1]
+}
+
+// matrixTime When the event was sent, according to the homeserver it was sent from
+func matrixTime(event matrixEvent) time.Time {
+	return time.Unix(0, event.OriginServerTS*int64(time.Millisecond))
+}
+
+// matrixLocalpart The localpart of a Matrix user ID, ie "alice" for "@alice:example.org"
+func matrixLocalpart(userID string) string {
+	return strings.TrimPrefix(strings.SplitN(userID, ":", 2)[0], "@")
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// matrixStub A fake homeserver that hands out one scripted sync response per request
+type matrixStub struct {
+	lock  sync.Mutex
+	syncs []string
+	sent  chan string
+}
+
+func (s *matrixStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Bad token"}`))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, matrixClientPath)
+	switch {
+	case path == "/account/whoami":
+		w.Write([]byte(`{"user_id":"@respecbot:test"}`))
+	case path == "/sync":
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if len(s.syncs) == 0 {
+			// Out of script, pretend the token was revoked so Listen returns
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Logged out"}`))
+			return
+		}
+		w.Write([]byte(s.syncs[0]))
+		s.syncs = s.syncs[1:]
+	case path == "/rooms/!room:test/state/m.room.power_levels/":
+		w.Write([]byte(`{"users":{"@alice:test":50,"@dave:test":100},"users_default":0}`))
+	case path == "/rooms/!room:test/event/$reply":
+		w.Write([]byte(`{"type":"m.room.message","event_id":"$reply","sender":"@respecbot:test"}`))
+	case strings.HasPrefix(path, "/rooms/!room:test/event/"):
+		w.Write([]byte(`{"type":"m.room.message","event_id":"$old","sender":"@carol:test"}`))
+	case strings.HasPrefix(path, "/rooms/!room:test/send/m.room.message/"):
+		var content map[string]string
+		json.NewDecoder(r.Body).Decode(&content)
+		s.sent <- content["body"]
+		w.Write([]byte(`{"event_id":"$reply"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *matrixStub) expect(t *testing.T, prefix string) {
+	select {
+	case body := <-s.sent:
+		if !strings.HasPrefix(body, prefix) {
+			t.Errorf("Expected reply starting with %q, got %q", prefix, body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("No reply starting with %q", prefix)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	if err := db.Setup("matrixtest.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteDB("matrixtest.db")
+	defer db.Close()
+
+	stub := &matrixStub{sent: make(chan string, 10)}
+	stub.syncs = []string{
+		// The initial sync is skipped
+		`{"next_batch":"s1","rooms":{"join":{"!room:test":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$0","sender":"@alice:test","content":{"msgtype":"m.text","body":"%version"}}]}}}}}`,
+		`{"next_batch":"s2","rooms":{"join":{"!room:test":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$1","sender":"@alice:test","content":{"msgtype":"m.text","body":"%lookatme"}}]}}}}}`,
+		`{"next_batch":"s3","rooms":{"join":{"!room:test":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$2","sender":"@alice:test","origin_server_ts":1500000000000,
+				"content":{"msgtype":"m.text","body":"bob: Hello there, how are you doing today?","m.mentions":{"user_ids":["@bob:test"]}}},
+			{"type":"m.reaction","event_id":"$3","sender":"@alice:test","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$old","key":"👍"}}},
+			{"type":"m.room.redaction","event_id":"$4","sender":"@alice:test","redacts":"$3","content":{}},
+			{"type":"m.reaction","event_id":"$6","sender":"@alice:test","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$reply","key":"👍"}}},
+			{"type":"m.room.message","event_id":"$5","sender":"@alice:test","content":{"msgtype":"m.text","body":"%version"}}]}}}}}`,
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	a, err := NewMatrix(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	listening := make(chan error, 1)
+	go func() {
+		listening <- a.Listen()
+	}()
+
+	stub.expect(t, "Fuck on me")
+	stub.expect(t, "Version")
+
+	select {
+	case err = <-listening:
+		if e, ok := err.(*matrixError); !ok || e.ErrCode != "M_UNKNOWN_TOKEN" {
+			t.Errorf("Unexpected error from Listen: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after the token was revoked")
+	}
+
+	channel := a.GetChannel("!room:test")
+	bob := a.GetUser("@bob:test")
+	carol := a.GetUser("@carol:test")
+	if channel == nil || bob == nil || carol == nil {
+		t.Fatal("Room or users not stored")
+	}
+	if channel.Server.ID != "test" {
+		t.Errorf("Room stored in wrong server %v", channel.Server.ID)
+	}
+	if respec := db.GetUserLocalRespec(bob, channel); respec != 3 {
+		t.Errorf("Mention not respected. Expected %v, got %v", 3, respec)
+	}
+	// The reaction was redacted within 5 minutes so it can't be taken back yet
+	if respec := db.GetUserLocalRespec(carol, channel); respec != 2 {
+		t.Errorf("Reaction not respected. Expected %v, got %v", 2, respec)
+	}
+	// Reactions to the bot's own messages don't respec it
+	if bot := db.GetUser("@respecbot:test", matrixName); bot != nil && db.GetUserLocalRespec(bot, channel) != 0 {
+		t.Error("Reaction to the bot was respected")
+	}
+	// Room admins only moderate their room, they can't change the settings of the whole homeserver
+	dave := &types.User{ID: "@dave:test"}
+	if permission, err := a.(types.PermissionAPI).UserPermission(channel, dave); err != nil || permission != types.Moderator {
+		t.Errorf("Room admin given permission %v", permission)
+	}
+	if len(stub.sent) != 0 {
+		t.Errorf("Events from the initial sync were handled")
+	}
+}
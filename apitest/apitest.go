@@ -0,0 +1,208 @@
+package apitest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// APIName The APIID of everything created by the fake API
+const APIName = "apitest"
+
+// Reply A reply sent by the bot
+type Reply struct {
+	// Content The reply rendered as plain text
+	Content string
+	Reply   *types.Reply
+	Message *types.Message
+}
+
+// API An in-memory types.API that records every reply and role change instead of sending it anywhere
+type API struct {
+	// MaxLength The longest reply that can be sent, longer ones are split into several replies. 0 if there is no limit
+	MaxLength int
+	mu        sync.Mutex
+	replies   []Reply
+	roles     map[string]map[string]bool
+	// serverRoles The roles created in each server by SetupRoles
+	serverRoles map[string]map[string]bool
+	permissions map[string]types.Permission
+	// roleChanges How many times a role has been added or removed
+	roleChanges int
+	// dispatcher Told when a command changes the tiers of a server, if it is set
+	dispatcher *events.Dispatcher
+	done       chan struct{}
+}
+
+var _ types.API = (*API)(nil)
+var _ types.RoleAPI = (*API)(nil)
+var _ types.PermissionAPI = (*API)(nil)
+var _ types.TierAPI = (*API)(nil)
+
+// NewAPI Create an empty fake API
+func NewAPI() *API {
+	a := new(API)
+	a.roles = make(map[string]map[string]bool)
+	a.serverRoles = make(map[string]map[string]bool)
+	a.permissions = make(map[string]types.Permission)
+	a.done = make(chan struct{})
+	return a
+}
+
+func (a *API) String() string {
+	return APIName
+}
+
+func (a *API) Setup() error {
+	return nil
+}
+
+// Listen Blocks until Close is called
+func (a *API) Listen() error {
+	<-a.done
+	return nil
+}
+
+func (a *API) Close() error {
+	close(a.done)
+	return nil
+}
+
+func (a *API) ReplyTo(reply *types.Reply, message *types.Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, v := range types.SplitMessage(reply.String(), a.MaxLength) {
+		a.replies = append(a.replies, Reply{Content: v, Reply: reply, Message: message})
+	}
+	return nil
+}
+
+func (a *API) MaxMessageLength() int {
+	return a.MaxLength
+}
+
+func (a *API) HandleCommand(message *types.Message) error {
+	commands.HandleCommand(a, message)
+	return nil
+}
+
+func (a *API) GetUser(userID string) *types.User {
+	return db.GetUser(userID, APIName)
+}
+
+func (a *API) GetChannel(channelID string) *types.Channel {
+	return db.GetChannel(channelID, APIName)
+}
+
+func (a *API) GetServer(serverID string) *types.Server {
+	return db.GetServer(serverID, APIName)
+}
+
+func (a *API) AddRole(server *types.Server, user *types.User, roleName string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := memberKey(server, user)
+	if a.roles[key] == nil {
+		a.roles[key] = make(map[string]bool)
+	}
+	a.roles[key][roleName] = true
+	a.roleChanges++
+	return nil
+}
+
+func (a *API) RemoveRole(server *types.Server, user *types.User, roleName string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.roles[memberKey(server, user)], roleName)
+	a.roleChanges++
+	return nil
+}
+
+func (a *API) TiersChanged(server *types.Server, removed []string) {
+	if a.dispatcher != nil {
+		a.dispatcher.Dispatch(events.TiersChanged{Server: server, Removed: removed})
+	}
+}
+
+func (a *API) MemberRoles(server *types.Server, user *types.User) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var roleNames []string
+	for k := range a.roles[memberKey(server, user)] {
+		roleNames = append(roleNames, k)
+	}
+	sort.Strings(roleNames)
+	return roleNames, nil
+}
+
+func (a *API) SetupRoles(server *types.Server, roleNames []string) (*types.RoleSetup, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.serverRoles[server.ID] == nil {
+		a.serverRoles[server.ID] = make(map[string]bool)
+	}
+	setup := new(types.RoleSetup)
+	for _, v := range roleNames {
+		if !a.serverRoles[server.ID][v] {
+			a.serverRoles[server.ID][v] = true
+			setup.Created = append(setup.Created, v)
+		}
+	}
+	return setup, nil
+}
+
+// UserPermission The permission given to the user with SetPermission, or Everyone if they haven't been given one
+func (a *API) UserPermission(channel *types.Channel, user *types.User) (types.Permission, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.permissions[user.ID], nil
+}
+
+// SetPermission Give the user a permission everywhere
+func (a *API) SetPermission(user *types.User, permission types.Permission) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.permissions[user.ID] = permission
+}
+
+// RoleChanges How many times a role has been added to or removed from anyone
+func (a *API) RoleChanges() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.roleChanges
+}
+
+// Replies Every reply sent so far, oldest first
+func (a *API) Replies() []Reply {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	replies := make([]Reply, len(a.replies))
+	copy(replies, a.replies)
+	return replies
+}
+
+// LastReply The content of the most recent reply, or "" if nothing has been sent
+func (a *API) LastReply() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.replies) == 0 {
+		return ""
+	}
+	return a.replies[len(a.replies)-1].Content
+}
+
+// HasRole Check if the user currently has the named role in the server
+func (a *API) HasRole(server *types.Server, user *types.User, roleName string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.roles[memberKey(server, user)][roleName]
+}
+
+func memberKey(server *types.Server, user *types.User) string {
+	return fmt.Sprintf("%v/%v", server.ID, user.ID)
+}
@@ -0,0 +1,167 @@
+package apitest
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/events"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// BotName Starting a message with @ and this name works as a command prefix
+const BotName = "respecbot"
+
+// Harness Scripts a conversation through the same pipeline every API uses, backed by a fake API and a throwaway database
+type Harness struct {
+	API        *API
+	Dispatcher *events.Dispatcher
+	// Now The timestamp given to the next message
+	Now        time.Time
+	dbName     string
+	messageNum int
+}
+
+// NewHarness Set up the database file dbName and a fake API to talk through.
+// The random source used for rating is seeded so results are repeatable
+func NewHarness(dbName string) (*Harness, error) {
+	if err := db.Setup(dbName); err != nil {
+		return nil, err
+	}
+	rand.Seed(1)
+	// Replies and role changes are sent as soon as they are queued
+	outbox.Replies = outbox.NewQueue(0, 0)
+	outbox.Roles = outbox.NewQueue(0, 0)
+	// Commands used by an earlier harness don't hold this one back
+	commands.ResetCooldowns()
+
+	h := new(Harness)
+	h.API = NewAPI()
+	h.Dispatcher = events.NewDispatcher(h.API)
+	h.API.dispatcher = h.Dispatcher
+	h.Now = time.Now()
+	h.dbName = dbName
+	return h, nil
+}
+
+// Close Close and delete the database used by the harness, and forget the cooldowns it started
+func (h *Harness) Close() error {
+	commands.ResetCooldowns()
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return db.DeleteDB(h.dbName)
+}
+
+// Wait Move the clock used for message timestamps forward
+func (h *Harness) Wait(d time.Duration) {
+	h.Now = h.Now.Add(d)
+}
+
+// User Get the user with the given name, creating them if they don't exist
+func (h *Harness) User(name string) *types.User {
+	user := db.GetUser(name, APIName)
+	if user == nil {
+		user = new(types.User)
+		user.ID = name
+		user.Name = name
+		user.APIID = APIName
+		db.NewUser(user)
+	}
+	return user
+}
+
+// Server Get the server with the given name, creating it if it doesn't exist
+func (h *Harness) Server(name string) *types.Server {
+	server := db.GetServer(name, APIName)
+	if server == nil {
+		server = new(types.Server)
+		server.ID = name
+		server.APIID = APIName
+		db.NewServer(server)
+	}
+	return server
+}
+
+// Channel Get the channel with the given name in the given server, creating it if it doesn't exist.
+// New channels are inactive, the same as on every other API
+func (h *Harness) Channel(serverName, name string) *types.Channel {
+	channelID := serverName + "#" + name
+	channel := db.GetChannel(channelID, APIName)
+	if channel == nil {
+		channel = new(types.Channel)
+		channel.ID = channelID
+		channel.Server = h.Server(serverName)
+		channel.ServerKey = channel.Server.Key
+		channel.APIID = APIName
+		channel.Active = false
+		db.NewChannel(channel)
+	}
+	return channel
+}
+
+// Say Post a message as the user in the channel, mentioning the given users. Starting it with @BotName addresses the bot.
+// The message is timestamped with h.Now, which is then moved forward by a few seconds
+func (h *Harness) Say(user *types.User, channel *types.Channel, content string, mentions ...*types.User) *types.Message {
+	// Load the channel again so state changed by earlier commands is seen
+	channel = h.API.GetChannel(channel.ID)
+
+	msg := new(types.Message)
+	msg.Author = user
+	msg.UserKey = user.Key
+	msg.Channel = channel
+	msg.ChannelKey = channel.Key
+	msg.Mentions = mentions
+	msg.Content, msg.Addressed = types.TrimMention(content, "@"+BotName)
+	msg.Time = h.Now
+
+	h.messageNum++
+	msg.ID = strconv.Itoa(h.messageNum)
+	msg.APIID = APIName
+
+	h.Wait(5 * time.Second)
+
+	h.dispatch(events.MessageCreated{Message: msg})
+	return msg
+}
+
+// dispatch Handle the event and wait for everything it sent to be sent
+func (h *Harness) dispatch(event events.Event) {
+	h.Dispatcher.Dispatch(event)
+	outbox.Flush()
+}
+
+// React Add a reaction from the giver to the message
+func (h *Harness) React(giver *types.User, message *types.Message) {
+	channel := h.API.GetChannel(message.Channel.ID)
+	h.dispatch(events.ReactionAdded{GiverID: giver.ID, Author: message.Author, Channel: channel, Time: h.Now})
+}
+
+// Unreact Remove a reaction from the giver on the message
+func (h *Harness) Unreact(giver *types.User, message *types.Message) {
+	channel := h.API.GetChannel(message.Channel.ID)
+	h.dispatch(events.ReactionRemoved{GiverID: giver.ID, Author: message.Author, Channel: channel, Time: h.Now})
+}
+
+// Join Have the user join the server
+func (h *Harness) Join(user *types.User, server *types.Server) {
+	h.dispatch(events.MemberJoined{User: user, Server: server})
+}
+
+// Respec The user's respec in the channel
+func (h *Harness) Respec(user *types.User, channel *types.Channel) int {
+	return db.GetUserLocalRespec(user, channel)
+}
+
+// ServerRespec The user's respec across every channel in the server
+func (h *Harness) ServerRespec(user *types.User, server *types.Server) int {
+	return db.GetUserServerRespec(user, server)
+}
+
+// Messages The last 'amount' messages stored for the user in the channel, newest first
+func (h *Harness) Messages(user *types.User, channel *types.Channel, amount int) []*types.Message {
+	return db.GetUserLastMessages(user, channel, amount)
+}
@@ -0,0 +1,400 @@
+package apitest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// newTestHarness A harness with a fresh database where alice is a server admin who has activated server#general
+func newTestHarness(t *testing.T) (*Harness, *types.Channel) {
+	h, err := NewHarness("apitest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := h.User("alice")
+	channel := h.Channel("server", "general")
+	h.API.SetPermission(alice, types.ServerAdmin)
+	h.Say(alice, channel, "%lookatme")
+	return h, channel
+}
+
+// chat Have alice, bob, carol and dave talk in the channel. Carol gets 3 respec from bob's mention, and dave 2 from bob's reaction
+func chat(h *Harness, channel *types.Channel) {
+	alice := h.User("alice")
+	bob := h.User("bob")
+	carol := h.User("carol")
+	dave := h.User("dave")
+	h.Say(alice, channel, "Hello everybody, how are you all doing today?")
+	h.Wait(time.Minute)
+	h.Say(bob, channel, "Pretty good thanks, what about you Carol?", carol)
+	h.Wait(time.Minute)
+	h.React(bob, h.Say(dave, channel, "Is anybody out there?"))
+}
+
+func TestHarness(t *testing.T) {
+	t.Run("rating", func(t *testing.T) {
+		h, err := NewHarness("apitest.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+
+		alice := h.User("alice")
+		bob := h.User("bob")
+		carol := h.User("carol")
+		dave := h.User("dave")
+		channel := h.Channel("server", "general")
+		server := channel.Server
+
+		// Nothing is rated before the channel is activated
+		early := h.Say(dave, channel, "Is anybody out there?")
+		if len(h.Messages(dave, channel, 1)) != 0 {
+			t.Error("Message stored in inactive channel")
+		}
+
+		// Only moderators can turn the bot on
+		h.Say(alice, channel, "%lookatme")
+		if h.API.LastReply() != "You need to be a moderator to use `lookatme`" {
+			t.Errorf("Unexpected reply to lookatme without permission: %v", h.API.LastReply())
+		}
+		h.API.SetPermission(alice, types.ServerAdmin)
+		h.Say(alice, channel, "%lookatme")
+		if h.API.LastReply() != "Fuck on me" {
+			t.Errorf("Unexpected reply to lookatme: %v", h.API.LastReply())
+		}
+
+		h.Say(alice, channel, "Hello everybody, how are you all doing today?")
+		h.Wait(time.Minute)
+		h.Say(bob, channel, "Pretty good thanks, what about you Carol?", carol)
+
+		if len(h.Messages(alice, channel, 5)) != 1 {
+			t.Error("Message not stored")
+		}
+		if h.Respec(carol, channel) != 3 {
+			t.Errorf("Mention not respected. Expected %v, got %v", 3, h.Respec(carol, channel))
+		}
+		// Changes are recorded at the time of the message, which the harness runs ahead of the real clock
+		if change := db.GetUserRespecChange(carol, server, h.Now.Add(-10*time.Second)); change != 3 {
+			t.Errorf("Respec change not recorded at the message's time. Expected %v, got %v", 3, change)
+		}
+
+		// Reacting to your own message does nothing
+		h.React(dave, early)
+		if h.Respec(dave, channel) != 0 {
+			t.Error("Self reaction was respected")
+		}
+		h.React(bob, early)
+		if h.Respec(dave, channel) != 2 {
+			t.Errorf("Reaction not respected. Expected %v, got %v", 2, h.Respec(dave, channel))
+		}
+		if h.ServerRespec(dave, server) != 2 {
+			t.Error("Server respec does not match channel respec")
+		}
+
+		top := db.GetServerTopUser(server)
+		if top == nil || !h.API.HasRole(server, top, types.SupremeRoleName) {
+			t.Error("Top user is not Supreme Ruler")
+		}
+		for _, v := range db.GetServerUsers(server) {
+			if v.ID != top.ID && h.API.HasRole(server, v, types.SupremeRoleName) {
+				t.Errorf("%v should not be Supreme Ruler", v.Name)
+			}
+			if h.API.HasRole(server, v, types.LoserRoleName) != v.UserIn(db.GetServerLosers(server)) {
+				t.Errorf("%v has the wrong Losers role", v.Name)
+			}
+		}
+
+		// Roles are only changed when standings change
+		changes := h.API.RoleChanges()
+		h.Join(dave, server)
+		if h.API.RoleChanges() != changes {
+			t.Errorf("Roles changed without standings changing. %v changes made", h.API.RoleChanges()-changes)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		chat(h, channel)
+		alice := h.User("alice")
+		bob := h.User("bob")
+		carol := h.User("carol")
+		dave := h.User("dave")
+
+		h.Say(bob, channel, "%stats")
+		if !strings.Contains(h.API.LastReply(), "carol") {
+			t.Errorf("Stats missing users: %v", h.API.LastReply())
+		}
+		replies := h.API.Replies()
+		if stats := replies[len(replies)-1].Reply; stats.Title != "Leaderboard" || len(stats.Table) != len(db.GetLocalStats(channel)) {
+			t.Errorf("Stats reply not structured: %+v", stats)
+		}
+
+		h.Say(bob, channel, "%profile @carol", carol)
+		if profile := h.API.LastReply(); !strings.HasPrefix(profile, "carol") || !strings.Contains(profile, "Channel: 3 respec, #") ||
+			!strings.Contains(profile, "Recent: +3 in the last day") {
+			t.Errorf("Unexpected profile: %v", profile)
+		}
+		// Mentions by ID find the user even when their name doesn't match
+		renamed := *carol
+		renamed.Name = "Carol C"
+		h.Say(bob, channel, "%profile <@!"+carol.ID+">", &renamed)
+		if profile := h.API.LastReply(); !strings.HasPrefix(profile, "Carol C") {
+			t.Errorf("Mention by ID not found: %v", profile)
+		}
+		h.Say(dave, channel, "%profile")
+		if profile := h.API.LastReply(); !strings.HasPrefix(profile, "dave") || !strings.Contains(profile, "Tiers: ") {
+			t.Errorf("Unexpected profile: %v", profile)
+		}
+
+		h.Say(bob, channel, "%rank @carol server", carol)
+		if rank := h.API.LastReply(); !strings.Contains(rank, "carol is #") || !strings.Contains(rank, "in this server with 3 respec") {
+			t.Errorf("Unexpected rank: %v", rank)
+		}
+		h.Say(bob, channel, "%rank global")
+		if rank := h.API.LastReply(); !strings.Contains(rank, "bob is #") || !strings.Contains(rank, "everywhere") {
+			t.Errorf("Unexpected rank: %v", rank)
+		}
+
+		h.Say(bob, channel, "%stats everywhere")
+		if h.API.LastReply() != "The scope must be one of local, server, global. Use `%stats [local|server|global] [page <number>] [sort desc|asc]`" {
+			t.Errorf("Unexpected reply to invalid arguments: %v", h.API.LastReply())
+		}
+
+		// Long leaderboards are split into pages that can be turned, and sorted either way
+		var mentions []*types.User
+		for i := 0; i < 16; i++ {
+			mentions = append(mentions, h.User(fmt.Sprintf("user%02d", i)))
+		}
+		h.Say(alice, channel, "Thanks everyone", mentions...)
+		h.Say(bob, channel, "%stats")
+		replies = h.API.Replies()
+		stats := replies[len(replies)-1].Reply
+		if stats.Footer != "Page 1 of 2" || len(stats.Table) != 16 || stats.Paging == nil || stats.Paging.Previous != "" ||
+			stats.Paging.Next != "stats page 2" || stats.Table[0][0] != "#1" {
+			t.Fatalf("Unexpected first page: %+v", stats)
+		}
+		h.Say(bob, channel, "%"+stats.Paging.Next)
+		replies = h.API.Replies()
+		if stats = replies[len(replies)-1].Reply; stats.Footer != "Page 2 of 2" || stats.Paging == nil || stats.Paging.Previous != "stats page 1" || stats.Paging.Next != "" {
+			t.Errorf("Unexpected last page: %+v", stats)
+		}
+		total := db.GetLeaderboardSize(channel, types.Guild)
+		h.Say(bob, channel, "%stats server page 1 sort asc")
+		replies = h.API.Replies()
+		if stats = replies[len(replies)-1].Reply; stats.Table[0][0] != fmt.Sprintf("#%v", total) || stats.Paging.Next != "stats page 2 sort asc server" {
+			t.Errorf("Unexpected ascending page: %+v", stats)
+		}
+		h.Say(bob, channel, "%stats page 99")
+		if h.API.LastReply() != "There is no page 99, the leaderboard in this channel has 2 pages" {
+			t.Errorf("Unexpected reply to a page past the end: %v", h.API.LastReply())
+		}
+	})
+
+	t.Run("tiers", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		chat(h, channel)
+		alice := h.User("alice")
+		server := channel.Server
+
+		h.Say(alice, channel, "%roles setup")
+		if !strings.Contains(h.API.LastReply(), "Created: "+types.SupremeRoleName) {
+			t.Errorf("Missing roles not created: %v", h.API.LastReply())
+		}
+
+		// Tiers added to the server get their role and are given out straight away
+		h.Say(alice, channel, `%tiers add "Top Two" top 2`)
+		if tiers := db.GetServerTiers(server); len(tiers) != 4 || tiers[3].Name != "Top Two" {
+			t.Errorf("Tier not added: %v", h.API.LastReply())
+		}
+		for k, v := range db.GetServerRespec(server) {
+			if h.API.HasRole(server, v.User, "Top Two") != (k < 2) {
+				t.Errorf("%v has the wrong Top Two role", v.User.Name)
+			}
+		}
+		h.Say(alice, channel, "%tiers add Nobody top none")
+		if !strings.Contains(h.API.LastReply(), "not a positive number") {
+			t.Errorf("Invalid tier accepted: %v", h.API.LastReply())
+		}
+		h.Say(alice, channel, "%roles setup")
+		if !strings.Contains(h.API.LastReply(), "All roles can be given out") {
+			t.Errorf("Roles of a new tier not created: %v", h.API.LastReply())
+		}
+
+		// Removing a tier takes its role off everyone who had it
+		h.Say(alice, channel, "%tiers remove 4")
+		for _, v := range db.GetServerUsers(server) {
+			if h.API.HasRole(server, v, "Top Two") {
+				t.Errorf("%v kept the role of a removed tier", v.Name)
+			}
+		}
+		if top := db.GetServerTopUser(server); !h.API.HasRole(server, top, types.SupremeRoleName) {
+			t.Error("Roles of the remaining tiers were taken off")
+		}
+	})
+
+	t.Run("owners", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		dave := h.User("dave")
+
+		// Owners can do anything, whatever their permission on the platform
+		h.Say(dave, channel, "%alias")
+		if h.API.LastReply() != "You need to be a server admin to use `alias`" {
+			t.Errorf("Unexpected reply to alias without permission: %v", h.API.LastReply())
+		}
+		if err := commands.SetOwners([]string{APIName + ":" + dave.ID}); err != nil {
+			t.Fatal(err)
+		}
+		defer commands.SetOwners(nil)
+		h.Say(dave, channel, "%alias")
+		if h.API.LastReply() != "Aliases\nThere are no aliases" {
+			t.Errorf("Owner could not use alias: %v", h.API.LastReply())
+		}
+	})
+
+	t.Run("prefixes and aliases", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		alice := h.User("alice")
+		bob := h.User("bob")
+
+		// Each server has its own prefix and aliases, and mentioning the bot always works
+		h.Say(alice, channel, "%prefix !")
+		h.Say(alice, channel, "%version")
+		if strings.HasPrefix(h.API.LastReply(), "Version") {
+			t.Error("Old prefix still works")
+		}
+		h.Say(alice, channel, "!alias add lb stats server")
+		h.Say(alice, channel, "!lb")
+		if replies := h.API.Replies(); replies[len(replies)-1].Reply.Title != "Leaderboard" {
+			t.Errorf("Alias did not run its command: %v", h.API.LastReply())
+		}
+		h.Say(alice, channel, "@"+BotName+": prefix reset")
+		if h.API.LastReply() != "Commands here now start with `%`" {
+			t.Errorf("Mention did not work as a prefix: %v", h.API.LastReply())
+		}
+		if other := h.Channel("other", "general"); commands.Prefix(other.Server) != "%" {
+			t.Error("Prefix changed in another server")
+		}
+
+		h.Say(bob, channel, "%help tiers add")
+		if help := h.API.LastReply(); !strings.HasPrefix(help, "%tiers add") || !strings.Contains(help, "`%tiers add <name> <top|percentile|share|score|rank> <limit> [highest]`") ||
+			!strings.Contains(help, "A server admin") || !strings.Contains(help, "Active channels only: Yes") {
+			t.Errorf("Unexpected help for a subcommand: %v", help)
+		}
+		h.Say(bob, channel, "%help lb")
+		if help := h.API.LastReply(); !strings.HasPrefix(help, "%stats") || !strings.Contains(help, "An alias for `%stats server`") {
+			t.Errorf("Unexpected help for an alias: %v", help)
+		}
+		h.Say(bob, channel, "%help notacommand")
+		if h.API.LastReply() != "I do not have command `notacommand`" {
+			t.Errorf("Unexpected help for an unknown command: %v", h.API.LastReply())
+		}
+		h.Say(bob, channel, "%notacommand")
+		if h.API.LastReply() != "I do not have command `notacommand`" {
+			t.Errorf("Unexpected reply to unknown command: %v", h.API.LastReply())
+		}
+
+		// Typos get suggestions, including aliases, unless the server ignores unknown commands
+		h.Say(bob, channel, "%stast")
+		if h.API.LastReply() != "I do not have command `stast`. Did you mean `%stats`?" {
+			t.Errorf("Unexpected suggestion: %v", h.API.LastReply())
+		}
+		h.Say(bob, channel, "%b")
+		if h.API.LastReply() != "I do not have command `b`. Did you mean `%lb`?" {
+			t.Errorf("Unexpected suggestion of an alias: %v", h.API.LastReply())
+		}
+
+		// A command registered with the name of an alias runs instead of it
+		err := commands.Register("test", "lb", commands.CmdFuncHelpType{Overwriteable: true, Help: "Not the leaderboard",
+			Function: func(api types.API, message *types.Message, args *commands.Args) {
+				api.ReplyTo(types.NewReply("Registered lb"), message)
+			}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer commands.Unregister("test", "lb")
+		h.Say(bob, channel, "%lb")
+		if h.API.LastReply() != "Registered lb" {
+			t.Errorf("Alias shadowed a registered command: %v", h.API.LastReply())
+		}
+		h.Say(bob, channel, "%help lb")
+		if help := h.API.LastReply(); !strings.HasPrefix(help, "%lb") || strings.Contains(help, "An alias") {
+			t.Errorf("Unexpected help for a command with an alias's name: %v", help)
+		}
+
+		h.Say(alice, channel, "%unknown ignore")
+		count := len(h.API.Replies())
+		h.Say(bob, channel, "%stast")
+		if len(h.API.Replies()) != count {
+			t.Errorf("Unknown command got a reply when they are ignored: %v", h.API.LastReply())
+		}
+	})
+
+	t.Run("cooldowns", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		alice := h.User("alice")
+		bob := h.User("bob")
+		carol := h.User("carol")
+
+		// Commands with cooldowns can't be spammed, except by admins
+		h.Say(bob, channel, "%card")
+		h.Say(bob, channel, "%card")
+		if h.API.LastReply() != "Slow down, try `card` again in 5s" {
+			t.Errorf("Unexpected reply to a command on cooldown: %v", h.API.LastReply())
+		}
+		h.Say(carol, channel, "%card")
+		if strings.HasPrefix(h.API.LastReply(), "Slow down") {
+			t.Error("Cooldown for one user held back another")
+		}
+		h.Say(alice, channel, "%card")
+		h.Say(alice, channel, "%card")
+		if strings.HasPrefix(h.API.LastReply(), "Slow down") {
+			t.Error("Admin was held back by a cooldown")
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		h, channel := newTestHarness(t)
+		defer h.Close()
+		bob := h.User("bob")
+
+		// Middleware runs around every command, and a command that panics gets a reply
+		var ran []string
+		removeMiddleware := commands.Use(func(next commands.Handler) commands.Handler {
+			return func(inv *commands.Invocation) {
+				ran = append(ran, inv.Name)
+				next(inv)
+			}
+		})
+		defer removeMiddleware()
+		err := commands.Register("test", "explode", commands.CmdFuncHelpType{Overwriteable: true,
+			Function: func(api types.API, message *types.Message, args *commands.Args) { panic("boom") }})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer commands.Unregister("test", "explode")
+		h.Say(bob, channel, "%explode")
+		if h.API.LastReply() != "Something went wrong running `explode`" {
+			t.Errorf("Unexpected reply to a command that panicked: %v", h.API.LastReply())
+		}
+		h.Say(bob, channel, "%tiers add x top 1")
+		if len(ran) != 1 || ran[0] != "explode" {
+			t.Errorf("Middleware ran for a command that wasn't allowed: %v", ran)
+		}
+		removeMiddleware()
+		h.Say(bob, channel, "%version")
+		if len(ran) != 1 {
+			t.Errorf("Middleware ran after it was removed: %v", ran)
+		}
+	})
+}
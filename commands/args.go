@@ -0,0 +1,283 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// ArgType What kind of value an argument takes
+type ArgType uint
+
+const (
+	// ArgString A single word, or a quoted string that can have spaces in it
+	ArgString ArgType = iota
+	// ArgInt A whole number
+	ArgInt ArgType = iota
+	// ArgEnum One of the argument's Choices, ignoring case
+	ArgEnum ArgType = iota
+	// ArgUser A user mentioned in the message
+	ArgUser ArgType = iota
+	// ArgRest Everything left in the message, exactly as it was written. Must be the last argument
+	ArgRest ArgType = iota
+)
+
+// Arg One argument taken by a command. Optional arguments must come after the ones that aren't.
+// If what is given for an optional argument isn't a value it can take, it is left out and the value goes to the
+// arguments after it
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	// Choices The values an ArgEnum can take
+	Choices []string
+	// Named The argument is given as its name followed by its value, anywhere after the arguments that come before it.
+	// Named arguments are always optional
+	Named bool
+}
+
+// Args The arguments given to a command, by name
+type Args struct {
+	values map[string]interface{}
+}
+
+// Has Check if the argument was given
+func (a *Args) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String The value of an ArgString, ArgEnum, or ArgRest, or "" if it wasn't given. Enum values are lower case
+func (a *Args) String(name string) string {
+	s, _ := a.values[name].(string)
+	return s
+}
+
+// Int The value of an ArgInt, or 0 if it wasn't given
+func (a *Args) Int(name string) int {
+	i, _ := a.values[name].(int)
+	return i
+}
+
+// User The user given to an ArgUser, or nil if it wasn't given
+func (a *Args) User(name string) *types.User {
+	u, _ := a.values[name].(*types.User)
+	return u
+}
+
+func (arg Arg) String() string {
+	var s string
+	switch arg.Type {
+	case ArgEnum:
+		s = strings.Join(arg.Choices, "|")
+	case ArgRest:
+		s = arg.Name + "..."
+	default:
+		s = arg.Name
+	}
+	if arg.Named {
+		switch arg.Type {
+		case ArgEnum:
+		case ArgInt:
+			s = "<number>"
+		default:
+			s = "<value>"
+		}
+		return "[" + arg.Name + " " + s + "]"
+	}
+	if arg.Optional {
+		return "[" + s + "]"
+	}
+	return "<" + s + ">"
+}
+
+// argsUsage The arguments written the way they are shown in usage messages
+func argsUsage(spec []Arg) string {
+	var parts []string
+	for _, v := range spec {
+		parts = append(parts, v.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseArgs Read the arguments in text according to the spec. Users are looked up in the message's mentions
+func parseArgs(spec []Arg, text string, message *types.Message) (*Args, error) {
+	args := &Args{values: make(map[string]interface{})}
+	var positional []Arg
+	named := make(map[string]Arg)
+	for _, v := range spec {
+		if v.Named {
+			named[v.Name] = v
+		} else {
+			positional = append(positional, v)
+		}
+	}
+
+	var err error
+	for k, v := range positional {
+		if text, err = parseNamedArgs(named, text, args, message); err != nil {
+			return nil, err
+		}
+
+		if v.Type == ArgRest {
+			rest := strings.TrimSpace(text)
+			if rest == "" {
+				if !v.Optional {
+					return nil, fmt.Errorf("Missing %v", v.Name)
+				}
+				return args, nil
+			}
+			args.values[v.Name] = rest
+			return args, nil
+		}
+
+		arg, rest, err := types.NextArg(text)
+		if err != nil {
+			return nil, err
+		}
+		if arg == "" && rest == "" {
+			if !v.Optional {
+				return nil, fmt.Errorf("Missing %v", v.Name)
+			}
+			continue
+		}
+
+		value, err := parseArg(v, arg, message)
+		if err != nil {
+			// An optional argument that doesn't fit is left for the ones after it
+			if v.Optional && k < len(positional)-1 {
+				continue
+			}
+			return nil, err
+		}
+		args.values[v.Name] = value
+		text = rest
+	}
+	if text, err = parseNamedArgs(named, text, args, message); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) != "" {
+		return nil, fmt.Errorf("Too many arguments")
+	}
+	return args, nil
+}
+
+// parseNamedArgs Read any named arguments at the start of text. Returns the text after them
+func parseNamedArgs(named map[string]Arg, text string, args *Args, message *types.Message) (string, error) {
+	for len(named) > 0 {
+		name, rest, err := types.NextArg(text)
+		if err != nil {
+			return "", err
+		}
+		v, ok := named[strings.ToLower(name)]
+		if !ok || args.Has(v.Name) {
+			return text, nil
+		}
+		arg, rest, err := types.NextArg(rest)
+		if err != nil {
+			return "", err
+		}
+		if arg == "" && rest == "" {
+			return "", fmt.Errorf("Missing the %v after '%v'", v.Name, name)
+		}
+		value, err := parseArg(v, arg, message)
+		if err != nil {
+			return "", err
+		}
+		args.values[v.Name] = value
+		text = rest
+	}
+	return text, nil
+}
+
+// parseArg Read the value of one argument
+func parseArg(v Arg, arg string, message *types.Message) (interface{}, error) {
+	switch v.Type {
+	case ArgInt:
+		i, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("The %v must be a whole number", v.Name)
+		}
+		return i, nil
+	case ArgEnum:
+		choice, ok := matchChoice(arg, v.Choices)
+		if !ok {
+			return nil, fmt.Errorf("The %v must be one of %v", v.Name, strings.Join(v.Choices, ", "))
+		}
+		return choice, nil
+	case ArgUser:
+		user := mentionedUser(arg, message)
+		if user == nil {
+			return nil, fmt.Errorf("The %v must be a mentioned user", v.Name)
+		}
+		return user, nil
+	}
+	return arg, nil
+}
+
+func matchChoice(arg string, choices []string) (string, bool) {
+	for _, v := range choices {
+		if strings.EqualFold(arg, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// mentionedUser The user mentioned in the message that the argument is. The argument can be the user's ID or name,
+// written as it is or as @user, <@user>, or <@!user>. IDs are checked first, since names can be out of date
+func mentionedUser(arg string, message *types.Message) *types.User {
+	arg = strings.TrimRight(arg, ":,")
+	mention := strings.TrimPrefix(arg, "@")
+	if strings.HasPrefix(arg, "<@") && strings.HasSuffix(arg, ">") {
+		mention = strings.TrimPrefix(arg[2:len(arg)-1], "!")
+	}
+	for _, v := range message.Mentions {
+		if v.ID == arg || v.ID == mention {
+			return v
+		}
+	}
+	for _, v := range message.Mentions {
+		if strings.EqualFold(v.Name, mention) {
+			return v
+		}
+	}
+	return nil
+}
+
+// CommandText Write the command with the given name and subcommands the way HandleCommand reads it, for APIs that
+// are given the arguments one at a time. value gives the value of each argument, an argument it doesn't have is left
+// out along with every argument after it
+func CommandText(names []string, value func(Arg) (string, bool)) string {
+	if len(names) == 0 {
+		return ""
+	}
+	cmd, _ := Command(names[0])
+	for _, v := range names[1:] {
+		cmd = cmd.Subcommands[v]
+	}
+
+	// Named arguments go before the others, in case the last one takes the rest of the text
+	parts := append([]string{}, names...)
+	for _, v := range cmd.Args {
+		if s, ok := value(v); ok && v.Named {
+			parts = append(parts, v.Name, types.QuoteArg(s))
+		}
+	}
+	for _, v := range cmd.Args {
+		if v.Named {
+			continue
+		}
+		s, ok := value(v)
+		if !ok {
+			break
+		}
+		if v.Type != ArgRest {
+			s = types.QuoteArg(s)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
@@ -1,13 +1,13 @@
 package commands
 
 import (
-	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Jaggernaut555/respecbot-v2/cards"
 	"github.com/Jaggernaut555/respecbot-v2/db"
-	"github.com/Jaggernaut555/respecbot-v2/rate"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
 	"github.com/Jaggernaut555/respecbot-v2/scripting"
 	"github.com/Jaggernaut555/respecbot-v2/types"
 	"github.com/Jaggernaut555/respecbot-v2/version"
@@ -15,103 +15,229 @@ import (
 
 // Constants
 const (
+	// CmdChar The prefix of commands in servers that haven't set their own
 	CmdChar = "%"
+	// leaderboardColor Gold
+	leaderboardColor = 0xFFD700
 )
 
 // CmdFuncType Command function type
-type CmdFuncType func(types.API, *types.Message, []string)
+type CmdFuncType func(types.API, *types.Message, *Args)
 
 // CmdFuncHelpType The type stored in the CmdFuncs map to map a function and helper text to a command
 type CmdFuncHelpType struct {
-	Function           CmdFuncType
-	Help               string
+	// Function Runs the command. A command with subcommands can leave it nil if one of them must always be given
+	Function CmdFuncType
+	// Help One line about what the command does, shown in the list of commands
+	Help string
+	// Description Everything about the command, shown by 'help <command>'. Help is shown if it's empty
+	Description string
+	// Examples Ways to use the command, written without the prefix
+	Examples           []string
 	AllowedChannelOnly bool
 	Overwriteable      bool
+	// Permission What a user needs to be allowed to run the command. Subcommands also need their parent's permission
+	Permission types.Permission
+	// Args The arguments the command takes, in order
+	Args []Arg
+	// Subcommands Commands run by giving their name as the first argument
+	Subcommands CmdFuncsType
+	// Cooldown How long to wait before using the command again. Server admins don't have to wait
+	Cooldown Cooldown
 }
 
 // CmdFuncsType The type of the CmdFuncs map
 type CmdFuncsType map[string]CmdFuncHelpType
 
-// cmdFuncs Commands to functions map
-var cmdFuncs CmdFuncsType
-
-// Initializes the cmds map
+// Registers the builtin commands
 func init() {
-	cmdFuncs = CmdFuncsType{
-		"help":     CmdFuncHelpType{cmdHelp, "Prints this list", false, false},
-		"lookatme": CmdFuncHelpType{cmdHere, "Fuck off, user", false, false},
-		"fuckoff":  CmdFuncHelpType{cmdNotHere, "Fuck off, bot", true, false},
-		"version":  CmdFuncHelpType{cmdVersion, "Outputs the current bot version", true, false},
-		"stats":    CmdFuncHelpType{cmdStats, "Displays leaderbaord, optionally use 'stats server' or 'stats global'", true, false},
-		"card":     CmdFuncHelpType{cmdCard, "IS A CARD", true, false},
-		"lua":      CmdFuncHelpType{cmdLua, "Lua", true, false},
-	}
+	registerBuiltins(CmdFuncsType{
+		"help": {Function: cmdHelp, Help: "Prints this list, or everything about one command",
+			Description: "Lists every command. Give a command, or a command and subcommand, to see everything about it",
+			Examples:    []string{"help", "help stats", "help tiers add"},
+			Args:        []Arg{{Name: "command", Type: ArgRest, Optional: true}}},
+		"lookatme": {Function: cmdHere, Help: "Fuck off, user", Permission: types.Moderator,
+			Description: "Makes this channel active. Messages in active channels are rated, and most commands only work in them"},
+		"fuckoff": {Function: cmdNotHere, Help: "Fuck off, bot", AllowedChannelOnly: true, Permission: types.Moderator,
+			Description: "Makes this channel inactive again. Messages are no longer rated and most commands stop working here"},
+		"version": {Function: cmdVersion, Help: "Outputs the current bot version", AllowedChannelOnly: true},
+		"stats": {Function: cmdStats, Help: "Displays the leaderboard for this channel, this server, or everywhere", AllowedChannelOnly: true,
+			Description: "Shows the leaderboard 16 users at a time, from the most respec down unless sorted 'asc'. " +
+				"Respec is counted in this channel unless 'server' or 'global' is given. Global respec combines linked accounts",
+			Examples: []string{"stats", "stats server", "stats global page 2", "stats sort asc"},
+			Args: []Arg{{Name: "scope", Type: ArgEnum, Optional: true, Choices: scopeChoices},
+				{Name: "page", Type: ArgInt, Named: true}, {Name: "sort", Type: ArgEnum, Named: true, Choices: sortChoices}}},
+		"rank": {Function: cmdRank, Help: "Shows where you, or someone else, are on the leaderboard and who is around them", AllowedChannelOnly: true,
+			Description: "Shows a user's position on the leaderboard of this channel, this server, or everywhere, with the users just above and below them",
+			Examples:    []string{"rank", "rank server", "rank @someone global"},
+			Args:        []Arg{{Name: "user", Type: ArgUser, Optional: true}, {Name: "scope", Type: ArgEnum, Optional: true, Choices: scopeChoices}}},
+		"profile": {Function: cmdProfile, Help: "Shows where you, or someone else, stand", AllowedChannelOnly: true,
+			Description: "Shows a user's respec and rank in this channel, this server, and everywhere, the tiers they are in, " +
+				"when they last said something here, and how much respec they gained or lost recently",
+			Examples: []string{"profile", "profile @someone"},
+			Args:     []Arg{{Name: "user", Type: ArgUser, Optional: true}}},
+		"card": {Function: cmdCard, Help: "IS A CARD", AllowedChannelOnly: true,
+			Description: "Draws a random card from a shuffled deck",
+			Cooldown:    Cooldown{User: 5 * time.Second}},
+		"lua": {Function: cmdLua, Help: "Lua", AllowedChannelOnly: true,
+			Description: "Runs a lua script in a code block and shows what it returns. The types it returns must be given after 'return', " +
+				"as int, float, bool, or string. Variables can be given before 'return' as name=value, quote values with spaces. " +
+				"Scripts are stopped after 500 instructions or 10MB of memory",
+			Args:     []Arg{{Name: "script", Type: ArgRest}},
+			Cooldown: Cooldown{User: 15 * time.Second, Channel: 5 * time.Second, Global: time.Second}},
+		"link": {Function: cmdLink, Help: "Link this account to one on another platform, or redeem a code from another platform",
+			Description: "Gives a code to use with 'link' on another platform within 10 minutes. Linked accounts share their global respec",
+			Examples:    []string{"link", "link ABCD2345"},
+			Args:        []Arg{{Name: "code", Optional: true}}},
+		"unlink": {Function: cmdUnlink, Help: "Remove this account from the accounts it is linked to"},
+		"roles": {Help: "Manages the roles of this server's tiers", AllowedChannelOnly: true, Permission: types.ServerAdmin,
+			Subcommands: CmdFuncsType{
+				"setup": {Function: cmdRolesSetup, Help: "Creates any missing roles and checks they can be given out",
+					Description: "Creates a role for every tier that doesn't have one, then lists anything stopping the bot giving the roles out, " +
+						"like missing permissions or roles above the bot's own"},
+			}},
+		"prefix": {Function: cmdPrefix, Help: "Shows or changes the command prefix in this server", AllowedChannelOnly: true, Permission: types.ServerAdmin,
+			Description: "Commands start with the prefix, or with a mention of the bot. The prefix can be up to 5 symbols",
+			Examples:    []string{"prefix", "prefix !", "prefix reset"},
+			Args:        []Arg{{Name: "new prefix", Optional: true}},
+			Subcommands: CmdFuncsType{
+				"reset": {Function: cmdPrefixReset, Help: "Goes back to the default prefix"},
+			}},
+		"alias": {Function: cmdAlias, Help: "Lists the aliases in this server", AllowedChannelOnly: true, Permission: types.ServerAdmin,
+			Subcommands: CmdFuncsType{
+				"add": {Function: cmdAliasAdd, Help: "Makes the alias run the command with the arguments given",
+					Description: "Makes the alias run the command with the arguments given. Anything given after the alias is added to the end",
+					Examples:    []string{"alias add lb stats server"},
+					Args:        []Arg{{Name: "name"}, {Name: "command"}, {Name: "arguments", Type: ArgRest, Optional: true}}},
+				"remove": {Function: cmdAliasRemove, Help: "Removes the alias", Args: []Arg{{Name: "name"}}},
+			}},
+		"unknown": {Function: cmdUnknown, Help: "Shows or changes whether unknown commands get a reply in this server", AllowedChannelOnly: true, Permission: types.ServerAdmin,
+			Description: "Commands the bot doesn't have get a reply suggesting the closest ones it does. Use 'ignore' to stop replying to them here",
+			Examples:    []string{"unknown ignore", "unknown reply"},
+			Args:        []Arg{{Name: "setting", Type: ArgEnum, Optional: true, Choices: []string{"reply", "ignore"}}}},
+		"tiers": {Function: cmdTiers, Help: "Lists the tiers of roles given out in this server", AllowedChannelOnly: true,
+			Description: "Members get the role of every tier they are in. Members are ranked by their respec in the server",
+			Subcommands: CmdFuncsType{
+				"add": {Function: cmdTiersAdd, Help: "Adds a tier. Use * for no limit on a score or rank", Permission: types.ServerAdmin,
+					Description: "Adds a tier after the others. 'top' is the highest ranked members, 'percentile' the highest ranked percent of members, " +
+						"'share' the highest ranked members holding a percent of the respec, and 'score' and 'rank' everyone between two limits. " +
+						"Use * for no limit on a score or rank. Members with negative respec are never in top, percentile, or share tiers",
+					Examples: []string{"tiers add \"Supreme Ruler\" top 1", "tiers add Elite percentile 10", "tiers add Losers score * -1", "tiers add Runners-up rank 2 5"},
+					Args: []Arg{
+						{Name: "name"},
+						{Name: "rule", Type: ArgEnum, Choices: tierRules},
+						{Name: "limit"},
+						{Name: "highest", Optional: true},
+					}},
+				"remove": {Function: cmdTiersRemove, Help: "Removes the tier at the position", Permission: types.ServerAdmin,
+					Args: []Arg{{Name: "position", Type: ArgInt}}},
+				"move": {Function: cmdTiersMove, Help: "Moves the tier at the position to a new one", Permission: types.ServerAdmin,
+					Examples: []string{"tiers move 3 1"},
+					Args:     []Arg{{Name: "position", Type: ArgInt}, {Name: "new position", Type: ArgInt}}},
+				"reset": {Function: cmdTiersReset, Help: "Goes back to the default tiers", Permission: types.ServerAdmin},
+			}},
+	})
 }
 
-func AddCommand(funcName string, f CmdFuncHelpType) error {
-	if f.Overwriteable == false {
-		return fmt.Errorf("Added function must be Overwriteable")
+func HandleCommand(api types.API, message *types.Message) {
+	cmd, text, err := types.NextArg(message.Content)
+	if err != nil || cmd == "" {
+		return
 	}
-	if v, ok := cmdFuncs[funcName]; (ok && v.Overwriteable) || !ok {
-		cmdFuncs[funcName] = f
-		return nil
+	cmd = strings.ToLower(cmd)
+	CmdFuncHelpPair, ok := Command(cmd)
+	// Commands come before aliases, so one registered after an alias with its name isn't hidden by it
+	if !ok {
+		if alias := getAlias(message.Channel.Server, cmd); alias != nil {
+			cmd, text, _ = types.NextArg(alias.Command + " " + text)
+			cmd = strings.ToLower(cmd)
+			CmdFuncHelpPair, ok = Command(cmd)
+		}
 	}
-	return fmt.Errorf("Cannot overwrite function '%v'", funcName)
-}
-
-func HandleCommand(api types.API, message *types.Message) {
-	args := strings.Fields(message.Content)
-	if len(args) == 0 {
+	if !ok {
+		if server := message.Channel.Server; server == nil || !server.IgnoreUnknown {
+			sendReply(api, message, unknownCommand(server, cmd))
+		}
 		return
 	}
-	cmd := args[0]
-	args = args[1:]
-	CmdFuncHelpPair, ok := cmdFuncs[cmd]
 
-	if ok {
-		if !CmdFuncHelpPair.AllowedChannelOnly || message.Channel.Active {
-			CmdFuncHelpPair.Function(api, message, args)
+	inv := &Invocation{API: api, Message: message, AllowedChannelOnly: CmdFuncHelpPair.AllowedChannelOnly}
+	inv.Command, inv.Name, inv.Permission, inv.Text = findSubcommand(CmdFuncHelpPair, cmd, text)
+	run(inv)
+}
+
+// findSubcommand Follow any subcommands named at the start of text. Returns the command that was found, its full name,
+// the permission needed to run it, and the rest of the text
+func findSubcommand(cmd CmdFuncHelpType, name, text string) (CmdFuncHelpType, string, types.Permission, string) {
+	permission := cmd.Permission
+	for len(cmd.Subcommands) > 0 {
+		arg, rest, _ := types.NextArg(text)
+		sub, ok := cmd.Subcommands[strings.ToLower(arg)]
+		if !ok {
+			break
+		}
+		name += " " + strings.ToLower(arg)
+		text = rest
+		cmd = sub
+		if sub.Permission > permission {
+			permission = sub.Permission
 		}
-	} else {
-		var reply = fmt.Sprintf("I do not have command `%s`", cmd)
-		api.ReplyTo(reply, message)
 	}
+	return cmd, name, permission, text
 }
 
-func cmdHelp(api types.API, message *types.Message, args []string) {
-	// Build array of the keys in CmdFuncs
+// usage How to use the command, and each of its subcommands, written for a reply
+func usage(server *types.Server, name string, cmd CmdFuncHelpType) string {
+	var usages []string
+	for _, v := range usageLines(name, cmd) {
+		usages = append(usages, "`"+Prefix(server)+v[0]+"`")
+	}
+	return strings.Join(usages, " or ")
+}
+
+// usageLines The usage and help of the command and every subcommand under it, subcommands sorted by name
+func usageLines(name string, cmd CmdFuncHelpType) [][]string {
+	var lines [][]string
+	if cmd.Function != nil {
+		line := name
+		if len(cmd.Args) > 0 {
+			line += " " + argsUsage(cmd.Args)
+		}
+		lines = append(lines, []string{line, cmd.Help})
+	}
 	var keys []string
-	for k := range cmdFuncs {
+	for k := range cmd.Subcommands {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-
-	// Build message (sorted by keys) of the commands
-	var cmds = "Command notation: \n`" + CmdChar + "[command] [arguments]`\n"
-	cmds += "Commands:\n```\n"
-	for _, key := range keys {
-		cmds += fmt.Sprintf("%s - %s\n", key, cmdFuncs[key].Help)
+	for _, k := range keys {
+		lines = append(lines, usageLines(name+" "+k, cmd.Subcommands[k])...)
 	}
-	cmds += "```\n"
-	api.ReplyTo(cmds, message)
+	return lines
 }
 
-func cmdVersion(api types.API, message *types.Message, args []string) {
-	reply := fmt.Sprintf("Version: %v", version.Version)
-	api.ReplyTo(reply, message)
+// sendReply Queue the reply to be sent to the message's channel. It is logged if it could not be sent
+func sendReply(api types.API, message *types.Message, reply *types.Reply) {
+	outbox.Replies.Send(message.Channel.APIID+" "+message.Channel.ID, "", func() error {
+		return api.ReplyTo(reply, message)
+	})
 }
 
-func cmdHere(api types.API, message *types.Message, args []string) {
+func cmdVersion(api types.API, message *types.Message, args *Args) {
+	sendReply(api, message, types.NewReplyf("Version: %v", version.Version))
+}
+
+func cmdHere(api types.API, message *types.Message, args *Args) {
 	if message.Channel.Active == true {
-		api.ReplyTo("Yeah", message)
+		sendReply(api, message, types.NewReply("Yeah"))
 		return
 	}
 	message.Channel.Active = true
 	db.UpdateChannel(message.Channel)
-	api.ReplyTo("Fuck on me", message)
+	sendReply(api, message, types.NewReply("Fuck on me"))
 }
 
-func cmdNotHere(api types.API, message *types.Message, args []string) {
+func cmdNotHere(api types.API, message *types.Message, args *Args) {
 	if message.Channel.Active == false {
 		return
 	}
@@ -119,35 +245,11 @@ func cmdNotHere(api types.API, message *types.Message, args []string) {
 	db.UpdateChannel(message.Channel)
 }
 
-func cmdStats(api types.API, message *types.Message, args []string) {
-	var leaders string
-	var losers []string
-	if len(args) < 1 {
-		leaders, losers = rate.GetRespec(message.Channel, types.Local)
-	} else {
-		switch strings.ToLower(args[0]) {
-		case "global":
-			leaders, losers = rate.GetRespec(message.Channel, types.Global)
-		case "server":
-			leaders, losers = rate.GetRespec(message.Channel, types.Guild)
-		default:
-			leaders, losers = rate.GetRespec(message.Channel, types.Local)
-		}
-	}
-	var stats = "Leaderboard:\n```\n"
-	stats += leaders
-	stats += "```"
-	stats += "\nLosers:` "
-	stats += strings.Join(losers, ", ")
-	stats += " `"
-	api.ReplyTo(stats, message)
-}
-
-func cmdCard(api types.API, message *types.Message, args []string) {
+func cmdCard(api types.API, message *types.Message, args *Args) {
 	card := cards.GenerateCard()
-	api.ReplyTo(card.String(), message)
+	sendReply(api, message, &types.Reply{Title: card.String()})
 }
 
-func cmdLua(api types.API, message *types.Message, args []string) {
-	scripting.Lua(api, message, args)
+func cmdLua(api types.API, message *types.Message, args *Args) {
+	sendReply(api, message, scripting.Lua(args.String("script")))
 }
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// cooldownOverride Users with this permission are never held back by cooldowns
+const cooldownOverride = types.ServerAdmin
+
+// cooldownSweep How many cooldowns are kept before the ones that have run out are removed
+const cooldownSweep = 1000
+
+// Cooldown How long to wait before a command can be used again. A zero duration has no cooldown
+type Cooldown struct {
+	// User How long the same user waits
+	User time.Duration
+	// Channel How long anyone in the same channel waits
+	Channel time.Duration
+	// Global How long anyone anywhere waits
+	Global time.Duration
+}
+
+// String The cooldown written for a help page
+func (c Cooldown) String() string {
+	var waits []string
+	if c.User > 0 {
+		waits = append(waits, fmt.Sprintf("%v per user", c.User))
+	}
+	if c.Channel > 0 {
+		waits = append(waits, fmt.Sprintf("%v per channel", c.Channel))
+	}
+	if c.Global > 0 {
+		waits = append(waits, fmt.Sprintf("%v everywhere", c.Global))
+	}
+	if len(waits) == 0 {
+		return "None"
+	}
+	return strings.Join(waits, ", ")
+}
+
+// cooldowns When each command can next be used, by who and where it was used
+var cooldowns = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+// useCooldown Start the command's cooldowns if it can be used now. Returns how much longer to wait if it can't
+func useCooldown(name string, cooldown Cooldown, message *types.Message) time.Duration {
+	keys := map[string]time.Duration{
+		"user " + message.Author.APIID + " " + message.Author.ID + " " + name:      cooldown.User,
+		"channel " + message.Channel.APIID + " " + message.Channel.ID + " " + name: cooldown.Channel,
+		"global " + name: cooldown.Global,
+	}
+
+	cooldowns.Lock()
+	defer cooldowns.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for k, v := range keys {
+		if v <= 0 {
+			continue
+		}
+		if left := cooldowns.until[k].Sub(now); left > wait {
+			wait = left
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if len(cooldowns.until) >= cooldownSweep {
+		for k, v := range cooldowns.until {
+			if !v.After(now) {
+				delete(cooldowns.until, k)
+			}
+		}
+	}
+	for k, v := range keys {
+		if v > 0 {
+			cooldowns.until[k] = now.Add(v)
+		}
+	}
+	return 0
+}
+
+// ResetCooldowns Forget every cooldown, so every command can be used again straight away
+func ResetCooldowns() {
+	cooldowns.Lock()
+	defer cooldowns.Unlock()
+	cooldowns.until = make(map[string]time.Time)
+}
+
+// waitString How long to wait, rounded up to a whole second
+func waitString(wait time.Duration) string {
+	return fmt.Sprintf("%vs", math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// cmdHelp List every command, or show everything about the command given
+func cmdHelp(api types.API, message *types.Message, args *Args) {
+	if args.Has("command") {
+		sendReply(api, message, commandHelp(message.Channel.Server, args.String("command")))
+		return
+	}
+
+	// Build array of the command names
+	all := Commands()
+	var keys []string
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Build a table (sorted by keys) of the commands
+	reply := new(types.Reply)
+	reply.Title = "Commands"
+	reply.Text = "Command notation: `" + Prefix(message.Channel.Server) + "[command] <argument> [optional argument]`. Put quotes around arguments with spaces. " +
+		"Use `" + Prefix(message.Channel.Server) + "help [command]` to see more about a command"
+	for _, key := range keys {
+		reply.Table = append(reply.Table, usageLines(key, all[key])...)
+	}
+	sendReply(api, message, reply)
+}
+
+// commandHelp The help page of the command, or subcommand, named in text
+func commandHelp(server *types.Server, text string) *types.Reply {
+	name, rest, err := types.NextArg(text)
+	if err != nil || name == "" {
+		return types.NewReply("Give the name of a command")
+	}
+
+	var aliasOf string
+	name = strings.ToLower(name)
+	cmd, ok := Command(name)
+	if !ok {
+		if alias := getAlias(server, name); alias != nil {
+			aliasOf = alias.Command
+			name, rest, _ = types.NextArg(alias.Command + " " + rest)
+			name = strings.ToLower(name)
+			cmd, ok = Command(name)
+		}
+	}
+	if !ok {
+		return unknownCommand(server, name)
+	}
+	activeOnly := "No"
+	if cmd.AllowedChannelOnly {
+		activeOnly = "Yes"
+	}
+	cmd, name, permission, _ := findSubcommand(cmd, name, rest)
+
+	prefix := Prefix(server)
+	reply := new(types.Reply)
+	reply.Title = prefix + name
+	reply.Text = cmd.Description
+	if reply.Text == "" {
+		reply.Text = cmd.Help
+	}
+	if aliasOf != "" {
+		reply.Text = "An alias for `" + prefix + aliasOf + "`. " + reply.Text
+	}
+
+	var usages []string
+	for _, v := range usageLines(name, cmd) {
+		usages = append(usages, "`"+prefix+v[0]+"` "+v[1])
+	}
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Usage", Value: strings.Join(usages, "\n")})
+
+	if len(cmd.Examples) > 0 {
+		var examples []string
+		for _, v := range cmd.Examples {
+			examples = append(examples, "`"+prefix+v+"`")
+		}
+		reply.Fields = append(reply.Fields, types.ReplyField{Name: "Examples", Value: strings.Join(examples, "\n")})
+	}
+
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Who can use it", Value: strings.ToUpper(permission.String()[:1]) + permission.String()[1:], Inline: true})
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Active channels only", Value: activeOnly, Inline: true})
+	if cmd.Cooldown != (Cooldown{}) {
+		reply.Fields = append(reply.Fields, types.ReplyField{Name: "Cooldown", Value: cmd.Cooldown.String(), Inline: true})
+	}
+	return reply
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+const (
+	linkCodeLength   = 8
+	linkCodeLifetime = 10 * time.Minute
+	// linkCodeLetters Letters that can't be mistaken for each other
+	linkCodeLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// cmdLink Issue a link code, or redeem one issued on another platform
+func cmdLink(api types.API, message *types.Message, args *Args) {
+	if args.Has("code") {
+		issuer, err := db.RedeemLinkCode(strings.ToUpper(args.String("code")), message.Author)
+		if err != nil {
+			sendReply(api, message, types.NewReply(err.Error()))
+			return
+		}
+		sendReply(api, message, types.NewReplyf("Linked to %v on %v", issuer.Name, issuer.APIID))
+		return
+	}
+
+	code, err := newLinkCode()
+	if err != nil {
+		sendReply(api, message, types.NewReply("Could not create a link code"))
+		return
+	}
+	linkCode := &types.LinkCode{Code: code, User: message.Author, Expires: time.Now().Add(linkCodeLifetime)}
+	if err = db.NewLinkCode(linkCode); err != nil {
+		sendReply(api, message, types.NewReply("Could not create a link code"))
+		return
+	}
+
+	reply := types.NewReplyf("Use `%vlink %v` on another platform in the next %v minutes to link it to this account", Prefix(message.Channel.Server), code, int(linkCodeLifetime.Minutes()))
+	if linked := linkedAccounts(message.Author); linked != "" {
+		reply.Fields = append(reply.Fields, types.ReplyField{Name: "Already linked to", Value: linked})
+	}
+	sendReply(api, message, reply)
+}
+
+// cmdUnlink Remove the author's account from the identity it is linked to
+func cmdUnlink(api types.API, message *types.Message, args *Args) {
+	if len(db.GetLinkedUsers(message.Author)) < 2 {
+		sendReply(api, message, types.NewReply("This account is not linked to anything"))
+		return
+	}
+	if err := db.UnlinkUser(message.Author); err != nil {
+		sendReply(api, message, types.NewReply("Could not unlink this account"))
+		return
+	}
+	sendReply(api, message, types.NewReply("Unlinked"))
+}
+
+// linkedAccounts List the other accounts linked to the user
+func linkedAccounts(user *types.User) string {
+	var accounts []string
+	for _, v := range db.GetLinkedUsers(user) {
+		if v.Key != user.Key {
+			accounts = append(accounts, fmt.Sprintf("%v on %v", v.Name, v.APIID))
+		}
+	}
+	return strings.Join(accounts, ", ")
+}
+
+func newLinkCode() (string, error) {
+	code := make([]byte, linkCodeLength)
+	max := big.NewInt(int64(len(linkCodeLetters)))
+	for k := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[k] = linkCodeLetters[n.Int64()]
+	}
+	return string(code), nil
+}
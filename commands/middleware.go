@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// Invocation A command being run for a message
+type Invocation struct {
+	API     types.API
+	Message *types.Message
+	// Name The full name of the command, including any subcommands
+	Name    string
+	Command CmdFuncHelpType
+	// AllowedChannelOnly Whether the command, or the command it is under, only runs in active channels
+	AllowedChannelOnly bool
+	// Permission What a user needs to run the command, including what the commands it is under need
+	Permission types.Permission
+	// Text The arguments as they were written
+	Text string
+	// Args The arguments read from Text, set once they have been parsed
+	Args *Args
+
+	userPermission *types.Permission
+}
+
+// UserPermission The permission of the user running the command. It is only looked up once
+func (inv *Invocation) UserPermission() types.Permission {
+	if inv.userPermission == nil {
+		permission := userPermission(inv.API, inv.Message.Channel, inv.Message.Author)
+		inv.userPermission = &permission
+	}
+	return *inv.userPermission
+}
+
+// Reply Send a reply to the message the command was run for
+func (inv *Invocation) Reply(reply *types.Reply) {
+	sendReply(inv.API, inv.Message, reply)
+}
+
+// Handler Runs a command, or the rest of the middleware before it
+type Handler func(*Invocation)
+
+// Middleware Wraps the handler that runs a command, to do something before or after it, or to stop it being run
+type Middleware func(next Handler) Handler
+
+// middlewareEntry Middleware added with Use, and which call to Use added it
+type middlewareEntry struct {
+	use int
+	m   Middleware
+}
+
+// middleware Run in order around every command, after the builtin middleware
+var middleware = struct {
+	sync.RWMutex
+	chain []middlewareEntry
+	uses  int
+}{}
+
+// builtinMiddleware Run in order around every command. A command is only run if each of these lets it
+var builtinMiddleware = []Middleware{recoverPanic, allowedChannelOnly, checkPermission, parseArguments, checkCooldown, logCommand}
+
+// Use Add middleware around every command. It runs after the middleware already added, closer to the command.
+// Returns a function that removes it again
+func Use(m ...Middleware) (remove func()) {
+	middleware.Lock()
+	defer middleware.Unlock()
+	middleware.uses++
+	use := middleware.uses
+	for _, v := range m {
+		middleware.chain = append(middleware.chain, middlewareEntry{use: use, m: v})
+	}
+	return func() {
+		middleware.Lock()
+		defer middleware.Unlock()
+		var chain []middlewareEntry
+		for _, v := range middleware.chain {
+			if v.use != use {
+				chain = append(chain, v)
+			}
+		}
+		middleware.chain = chain
+	}
+}
+
+// run Run the command through every middleware
+func run(inv *Invocation) {
+	middleware.RLock()
+	chain := append([]Middleware{}, builtinMiddleware...)
+	for _, v := range middleware.chain {
+		chain = append(chain, v.m)
+	}
+	middleware.RUnlock()
+
+	handler := runCommand
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	handler(inv)
+}
+
+// runCommand Run the command itself, once every middleware has let it
+func runCommand(inv *Invocation) {
+	inv.Command.Function(inv.API, inv.Message, inv.Args)
+}
+
+// recoverPanic A command that panics tells the user something went wrong instead of taking the bot down with it
+func recoverPanic(next Handler) Handler {
+	return func(inv *Invocation) {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.Err(fmt.Errorf("Command %v panicked: %v\n%s", inv.Name, r, debug.Stack()))
+				inv.Reply(types.NewReplyf("Something went wrong running `%v`", inv.Name))
+			}
+		}()
+		next(inv)
+	}
+}
+
+// logCommand Log who ran each command where, and how long it took. It comes after the middleware that can stop a
+// command, so only commands that actually ran are logged
+func logCommand(next Handler) Handler {
+	return func(inv *Invocation) {
+		start := time.Now()
+		next(inv)
+		logging.Log(fmt.Sprintf("%v used %v in %v on %v (%v)", inv.Message.Author.Name, inv.Name, inv.Message.Channel.ID, inv.API, time.Since(start)))
+	}
+}
+
+// allowedChannelOnly Commands that only run in active channels are ignored everywhere else
+func allowedChannelOnly(next Handler) Handler {
+	return func(inv *Invocation) {
+		if inv.AllowedChannelOnly && !inv.Message.Channel.Active {
+			return
+		}
+		next(inv)
+	}
+}
+
+// checkPermission Only users with the permission the command needs can run it
+func checkPermission(next Handler) Handler {
+	return func(inv *Invocation) {
+		if inv.UserPermission() < inv.Permission {
+			inv.Reply(types.NewReplyf("You need to be %v to use `%v`", inv.Permission, inv.Name))
+			return
+		}
+		next(inv)
+	}
+}
+
+// parseArguments Read the arguments of the command, or show how to use it if they are wrong
+func parseArguments(next Handler) Handler {
+	return func(inv *Invocation) {
+		server := inv.Message.Channel.Server
+		if inv.Command.Function == nil {
+			inv.Reply(types.NewReplyf("Use %v", usage(server, inv.Name, inv.Command)))
+			return
+		}
+		args, err := parseArgs(inv.Command.Args, inv.Text, inv.Message)
+		if err != nil {
+			inv.Reply(types.NewReplyf("%v. Use %v", err.Error(), usage(server, inv.Name, inv.Command)))
+			return
+		}
+		inv.Args = args
+		next(inv)
+	}
+}
+
+// checkCooldown Hold back users who used the command too recently, unless they can override cooldowns
+func checkCooldown(next Handler) Handler {
+	return func(inv *Invocation) {
+		if inv.UserPermission() < cooldownOverride {
+			if wait := useCooldown(inv.Name, inv.Command.Cooldown, inv.Message); wait > 0 {
+				inv.Reply(types.NewReplyf("Slow down, try `%v` again in %v", inv.Name, waitString(wait)))
+				return
+			}
+		}
+		next(inv)
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// owners The users who own the bot, as "api:userID"
+var owners = make(map[string]bool)
+
+// SetOwners Set the users who own the bot. Each owner is written as "api:userID", like "discord:1234" or
+// "matrix:@me:example.org". Anyone can take a nick on IRC, so owners there are written as their services account, like
+// "irc:$a:account", or their lower case user@host, like "irc:me@host.example"
+func SetOwners(users []string) error {
+	owners = make(map[string]bool)
+	for _, v := range users {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		s := strings.SplitN(v, ":", 2)
+		if len(s) < 2 || s[0] == "" || s[1] == "" {
+			return fmt.Errorf("Owner %v must be written as api:userID", v)
+		}
+		owners[s[0]+":"+s[1]] = true
+	}
+	return nil
+}
+
+// isOwner Check if the user owns the bot. Users of an API that verifies identities only own it once they are verified
+func isOwner(api types.API, user *types.User) bool {
+	id := user.ID
+	if identities, ok := api.(types.IdentityAPI); ok {
+		var verified bool
+		if id, verified = identities.Identity(user); !verified {
+			return false
+		}
+	}
+	return owners[user.APIID+":"+id]
+}
+
+// userPermission The highest permission the user has in the channel. Users on APIs that don't have permissions can only
+// do what everyone can, unless they own the bot
+func userPermission(api types.API, channel *types.Channel, user *types.User) types.Permission {
+	if isOwner(api, user) {
+		return types.BotOwner
+	}
+	permissions, ok := api.(types.PermissionAPI)
+	if !ok {
+		return types.Everyone
+	}
+	permission, err := permissions.UserPermission(channel, user)
+	if err != nil {
+		logging.Err(err)
+		return types.Everyone
+	}
+	return permission
+}
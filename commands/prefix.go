@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+const maxPrefixLength = 5
+
+// Prefix What commands start with in the server
+func Prefix(server *types.Server) string {
+	if server == nil || server.Prefix == "" {
+		return CmdChar
+	}
+	return server.Prefix
+}
+
+// getAlias The alias with the given name in the server, or nil if there isn't one
+func getAlias(server *types.Server, name string) *types.Alias {
+	if server == nil {
+		return nil
+	}
+	return db.GetServerAlias(server, strings.ToLower(name))
+}
+
+// cmdPrefix Show or change the prefix of commands in the server
+func cmdPrefix(api types.API, message *types.Message, args *Args) {
+	server := message.Channel.Server
+	if !args.Has("new prefix") {
+		sendReply(api, message, types.NewReplyf("Commands here start with `%v`, or by mentioning me", Prefix(server)))
+		return
+	}
+	prefix := args.String("new prefix")
+	if err := validPrefix(prefix); err != nil {
+		sendReply(api, message, types.NewReply(err.Error()))
+		return
+	}
+	setPrefix(api, message, prefix)
+}
+
+// cmdPrefixReset Go back to the default prefix in the server
+func cmdPrefixReset(api types.API, message *types.Message, args *Args) {
+	setPrefix(api, message, "")
+}
+
+func setPrefix(api types.API, message *types.Message, prefix string) {
+	server := message.Channel.Server
+	server.Prefix = prefix
+	if err := db.UpdateServerPrefix(server); err != nil {
+		sendReply(api, message, types.NewReply("Could not change the prefix"))
+		return
+	}
+	sendReply(api, message, types.NewReplyf("Commands here now start with `%v`", Prefix(server)))
+}
+
+func validPrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("The prefix can't be empty")
+	}
+	if len(prefix) > maxPrefixLength {
+		return fmt.Errorf("The prefix can't be longer than %v characters", maxPrefixLength)
+	}
+	for _, v := range prefix {
+		if unicode.IsSpace(v) || unicode.IsLetter(v) || unicode.IsDigit(v) || v == '"' {
+			return fmt.Errorf("The prefix can only have symbols in it, and can't have quotes")
+		}
+	}
+	return nil
+}
+
+// cmdUnknown Show or change whether unknown commands get a reply in the server
+func cmdUnknown(api types.API, message *types.Message, args *Args) {
+	server := message.Channel.Server
+	if !args.Has("setting") {
+		if server.IgnoreUnknown {
+			sendReply(api, message, types.NewReply("Unknown commands are ignored here"))
+		} else {
+			sendReply(api, message, types.NewReply("Unknown commands get a reply here"))
+		}
+		return
+	}
+	server.IgnoreUnknown = args.String("setting") == "ignore"
+	if err := db.UpdateServerIgnoreUnknown(server); err != nil {
+		sendReply(api, message, types.NewReply("Could not change the setting"))
+		return
+	}
+	if server.IgnoreUnknown {
+		sendReply(api, message, types.NewReply("Unknown commands will be ignored here"))
+	} else {
+		sendReply(api, message, types.NewReply("Unknown commands will get a reply here"))
+	}
+}
+
+// cmdAlias List the aliases in the server
+func cmdAlias(api types.API, message *types.Message, args *Args) {
+	sendReply(api, message, aliasesReply(db.GetServerAliases(message.Channel.Server)))
+}
+
+// cmdAliasAdd Make a name run a command with some arguments already given
+func cmdAliasAdd(api types.API, message *types.Message, args *Args) {
+	server := message.Channel.Server
+	name := strings.ToLower(args.String("name"))
+	if _, ok := Command(name); ok {
+		sendReply(api, message, types.NewReplyf("`%v` is already a command", name))
+		return
+	}
+	command := strings.ToLower(args.String("command"))
+	if _, ok := Command(command); !ok {
+		sendReply(api, message, types.NewReplyf("I do not have command `%v`", command))
+		return
+	}
+	if args.Has("arguments") {
+		command += " " + args.String("arguments")
+	}
+	alias := &types.Alias{Server: server, Name: name, Command: command}
+	if err := db.SetServerAlias(alias); err != nil {
+		sendReply(api, message, types.NewReply("Could not save the alias"))
+		return
+	}
+	sendReply(api, message, types.NewReplyf("`%v%v` now runs `%v%v`", Prefix(server), alias.Name, Prefix(server), alias.Command))
+}
+
+// cmdAliasRemove Remove an alias from the server
+func cmdAliasRemove(api types.API, message *types.Message, args *Args) {
+	name := strings.ToLower(args.String("name"))
+	if !db.DeleteServerAlias(message.Channel.Server, name) {
+		sendReply(api, message, types.NewReplyf("There is no alias named `%v`", name))
+		return
+	}
+	sendReply(api, message, types.NewReplyf("Removed alias `%v`", name))
+}
+
+func aliasesReply(aliases []*types.Alias) *types.Reply {
+	reply := new(types.Reply)
+	reply.Title = "Aliases"
+	if len(aliases) == 0 {
+		reply.Text = "There are no aliases"
+		return reply
+	}
+	for _, v := range aliases {
+		reply.Table = append(reply.Table, []string{v.Name, v.Command})
+	}
+	return reply
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/rate"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// profileColor Light blue
+const profileColor = 0x5DADE2
+
+// profileTimeFormat How the last time a user was active is shown
+const profileTimeFormat = "2006-01-02 15:04 MST"
+
+// cmdProfile Show where a user stands in this channel, this server, and everywhere
+func cmdProfile(api types.API, message *types.Message, args *Args) {
+	user := message.Author
+	if args.Has("user") {
+		user = args.User("user")
+	}
+	channel := message.Channel
+	server := channel.Server
+
+	reply := new(types.Reply)
+	reply.Title = user.Name
+	reply.Color = profileColor
+
+	reply.Fields = append(reply.Fields,
+		types.ReplyField{Name: "Channel", Value: standing(db.GetRank(user, channel, types.Local)), Inline: true},
+		types.ReplyField{Name: "Server", Value: standing(db.GetRank(user, channel, types.Guild)), Inline: true},
+		types.ReplyField{Name: "Global", Value: standing(db.GetRank(user, channel, types.Global)), Inline: true},
+	)
+
+	_, memberTiers := rate.GetServerTierRoles(server)
+	tiers := "None"
+	if len(memberTiers[user.Key]) > 0 {
+		tiers = strings.Join(memberTiers[user.Key], ", ")
+	}
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Tiers", Value: tiers, Inline: true})
+
+	lastActive := "Never"
+	if last := db.GetUserLastServerMessage(user, server); last != nil {
+		lastActive = last.Time.Format(profileTimeFormat)
+	}
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Last active", Value: lastActive, Inline: true})
+
+	now := time.Now()
+	recent := fmt.Sprintf("%+d in the last day, %+d in the last week",
+		db.GetUserRespecChange(user, server, now.Add(-24*time.Hour)), db.GetUserRespecChange(user, server, now.Add(-7*24*time.Hour)))
+	reply.Fields = append(reply.Fields, types.ReplyField{Name: "Recent", Value: recent, Inline: true})
+
+	sendReply(api, message, reply)
+}
+
+// standing A user's rank out of how many are ranked, and their respec, written for a profile
+func standing(rank, total, respec int) string {
+	if rank == 0 {
+		return fmt.Sprintf("%v respec, unranked", respec)
+	}
+	return fmt.Sprintf("%v respec, #%v of %v", respec, rank, total)
+}
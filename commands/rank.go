@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// rankNeighbours How many users above and below a user are shown with their rank
+const rankNeighbours = 3
+
+// scopeChoices The scopes a leaderboard can be shown for
+var scopeChoices = []string{"local", "server", "global"}
+
+// argScope The scope given to the 'scope' argument. Local if it wasn't given
+func argScope(args *Args) types.Scope {
+	switch args.String("scope") {
+	case "global":
+		return types.Global
+	case "server":
+		return types.Guild
+	}
+	return types.Local
+}
+
+// scopeName Where the scope is, written for a reply
+func scopeName(scope types.Scope) string {
+	switch scope {
+	case types.Global:
+		return "everywhere"
+	case types.Guild:
+		return "in this server"
+	}
+	return "in this channel"
+}
+
+// cmdRank Show a user's position on a leaderboard with the users around them
+func cmdRank(api types.API, message *types.Message, args *Args) {
+	user := message.Author
+	if args.Has("user") {
+		user = args.User("user")
+	}
+	scope := argScope(args)
+	rank, total, respec := db.GetRank(user, message.Channel, scope)
+	if rank == 0 {
+		sendReply(api, message, types.NewReplyf("%v isn't ranked %v", user.Name, scopeName(scope)))
+		return
+	}
+
+	reply := new(types.Reply)
+	reply.Title = "Rank"
+	reply.Color = leaderboardColor
+	reply.Text = fmt.Sprintf("%v is #%v of %v %v with %v respec", user.Name, rank, total, scopeName(scope), respec)
+
+	offset := rank - 1 - rankNeighbours
+	if offset < 0 {
+		offset = 0
+	}
+	for k, v := range db.GetLeaderboard(message.Channel, scope, offset, 2*rankNeighbours+1, false) {
+		name := "unknown"
+		if v.User != nil {
+			name = v.User.Name
+		}
+		position := offset + k + 1
+		marker := ""
+		if position == rank {
+			marker = "<"
+		}
+		reply.Table = append(reply.Table, []string{"#" + strconv.Itoa(position), name, strconv.Itoa(v.Respec), marker})
+	}
+	sendReply(api, message, reply)
+}
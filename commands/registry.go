@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BuiltinOwner The owner of the commands the bot starts with
+const BuiltinOwner = "respecbot"
+
+// AddCommandOwner The owner of the commands added with AddCommand
+const AddCommandOwner = "addcommand"
+
+// registration A command and who registered it
+type registration struct {
+	cmd   CmdFuncHelpType
+	owner string
+}
+
+// registry Every command by name. Commands are registered and looked up from any goroutine, so it is always locked
+var registry = struct {
+	sync.RWMutex
+	commands map[string]registration
+}{commands: make(map[string]registration)}
+
+// registerBuiltins Register the commands the bot starts with. They can't be overwritten unless they are Overwriteable
+func registerBuiltins(builtins CmdFuncsType) {
+	registry.Lock()
+	defer registry.Unlock()
+	for k, v := range builtins {
+		registry.commands[k] = registration{cmd: v, owner: BuiltinOwner}
+	}
+}
+
+// Register Add a command owned by owner, who is the only one that can unregister it.
+// The command must be Overwriteable. It can replace a builtin command that is Overwriteable, which then belongs to
+// the new owner, or a command the same owner registered. Commands of other owners can't be replaced
+func Register(owner, name string, cmd CmdFuncHelpType) error {
+	if owner == "" || owner == BuiltinOwner {
+		return fmt.Errorf("Command '%v' must have an owner other than %v", name, BuiltinOwner)
+	}
+	if name == "" || name != strings.ToLower(name) || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("Command '%v' must be lower case without spaces", name)
+	}
+	if !cmd.Overwriteable {
+		return fmt.Errorf("Registered command '%v' must be Overwriteable", name)
+	}
+	if cmd.Function == nil && len(cmd.Subcommands) == 0 {
+		return fmt.Errorf("Command '%v' has nothing to run", name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if v, ok := registry.commands[name]; ok {
+		if !v.cmd.Overwriteable {
+			return fmt.Errorf("Cannot overwrite command '%v'", name)
+		}
+		if v.owner != BuiltinOwner && v.owner != owner {
+			return fmt.Errorf("Command '%v' belongs to %v", name, v.owner)
+		}
+	}
+	registry.commands[name] = registration{cmd: cmd, owner: owner}
+	return nil
+}
+
+// AddCommand Register a command owned by AddCommandOwner. Use Register so that only you can replace or remove it
+func AddCommand(funcName string, f CmdFuncHelpType) error {
+	return Register(AddCommandOwner, funcName, f)
+}
+
+// Unregister Remove a command. Only the owner that registered it can remove it, and builtin commands can't be removed
+func Unregister(owner, name string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	v, ok := registry.commands[name]
+	if !ok {
+		return fmt.Errorf("There is no command '%v'", name)
+	}
+	if v.owner == BuiltinOwner {
+		return fmt.Errorf("Command '%v' is built in and can't be unregistered", name)
+	}
+	if v.owner != owner {
+		return fmt.Errorf("Command '%v' belongs to %v", name, v.owner)
+	}
+	delete(registry.commands, name)
+	return nil
+}
+
+// Command The command with the name, if there is one
+func Command(name string) (CmdFuncHelpType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	v, ok := registry.commands[name]
+	return v.cmd, ok
+}
+
+// Commands Every command, by name
+func Commands() CmdFuncsType {
+	registry.RLock()
+	defer registry.RUnlock()
+	commands := make(CmdFuncsType)
+	for k, v := range registry.commands {
+		commands[k] = v.cmd
+	}
+	return commands
+}
+
+// Owned The names of the commands registered by owner
+func Owned(owner string) []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var names []string
+	for k, v := range registry.commands {
+		if v.owner == owner {
+			names = append(names, k)
+		}
+	}
+	return names
+}
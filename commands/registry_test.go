@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+func TestRegistry(t *testing.T) {
+	noop := func(api types.API, message *types.Message, args *Args) {}
+	cmd := CmdFuncHelpType{Function: noop, Help: "Does nothing", Overwriteable: true}
+
+	if err := Register("plugin", "help", cmd); err == nil {
+		t.Error("Builtin command was overwritten")
+	}
+	if err := Register("plugin", "nothing", CmdFuncHelpType{Function: noop}); err == nil {
+		t.Error("Command that can't be overwritten was registered")
+	}
+	if err := Register("plugin", "Two words", cmd); err == nil {
+		t.Error("Command with an invalid name was registered")
+	}
+	if err := Register("plugin", "nothing", cmd); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Command("nothing"); !ok {
+		t.Error("Registered command not found")
+	}
+	if err := Unregister("other", "nothing"); err == nil {
+		t.Error("Command was unregistered by another owner")
+	}
+	if err := Unregister(BuiltinOwner, "help"); err == nil {
+		t.Error("Builtin command was unregistered")
+	}
+
+	// Only the owner of a command can replace it
+	if err := Register("other", "nothing", cmd); err == nil {
+		t.Error("Command was overwritten by another owner")
+	}
+	if err := Register("plugin", "nothing", cmd); err != nil {
+		t.Errorf("Owner could not replace their command: %v", err)
+	}
+	if owned := Owned("other"); len(owned) != 0 {
+		t.Errorf("Unexpected commands owned: %v", owned)
+	}
+	if err := Unregister("plugin", "nothing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Command("nothing"); ok {
+		t.Error("Unregistered command still found")
+	}
+
+	if err := AddCommand("added", cmd); err != nil {
+		t.Fatal(err)
+	}
+	if owned := Owned(AddCommandOwner); len(owned) != 1 || owned[0] != "added" {
+		t.Errorf("Unexpected commands owned: %v", owned)
+	}
+	if err := Register("plugin", "added", cmd); err == nil {
+		t.Error("Added command was overwritten by a plugin")
+	}
+	Unregister(AddCommandOwner, "added")
+
+	// Commands are registered and run at the same time on different goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("cmd%v", i)
+			for j := 0; j < 100; j++ {
+				Register("plugin", name, cmd)
+				Command("help")
+				Commands()
+				Unregister("plugin", name)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(Owned("plugin")) != 0 {
+		t.Errorf("Commands left behind: %v", Owned("plugin"))
+	}
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// cmdRolesSetup Create the roles of the server's tiers and report anything stopping them being given out
+func cmdRolesSetup(api types.API, message *types.Message, args *Args) {
+	roles, ok := api.(types.RoleAPI)
+	if !ok {
+		sendReply(api, message, types.NewReplyf("Roles can't be given out on %v", api.String()))
+		return
+	}
+
+	server := message.Channel.Server
+	var roleNames []string
+	for _, v := range db.GetServerTiers(server) {
+		roleNames = append(roleNames, v.Name)
+	}
+	// Queued with the server's other role changes, so the setup happens in order with them
+	outbox.Roles.Send(server.APIID+" "+server.ID, "", func() error {
+		setup, err := roles.SetupRoles(server, roleNames)
+		if err != nil {
+			sendReply(api, message, types.NewReply("Could not set up the roles"))
+			return err
+		}
+		sendReply(api, message, roleSetupReply(setup, len(roleNames)))
+		return nil
+	})
+}
+
+func roleSetupReply(setup *types.RoleSetup, roleCount int) *types.Reply {
+	reply := new(types.Reply)
+	reply.Title = "Roles"
+	if len(setup.Problems) == 0 {
+		reply.Text = "All roles can be given out"
+		if roleCount == 0 {
+			reply.Text = "There are no tiers, so there are no roles to set up"
+		}
+	}
+	if len(setup.Created) > 0 {
+		reply.Fields = append(reply.Fields, types.ReplyField{Name: "Created", Value: strings.Join(setup.Created, ", ")})
+	}
+	if len(setup.Problems) > 0 {
+		reply.Fields = append(reply.Fields, types.ReplyField{Name: "Problems", Value: strings.Join(setup.Problems, "\n")})
+	}
+	return reply
+}
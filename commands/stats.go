@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// statsPageSize How many users are shown on each page of the leaderboard
+const statsPageSize = 16
+
+// sortChoices The orders a leaderboard can be shown in
+var sortChoices = []string{"desc", "asc"}
+
+// cmdStats Show one page of a leaderboard
+func cmdStats(api types.API, message *types.Message, args *Args) {
+	scope := argScope(args)
+	ascending := args.String("sort") == "asc"
+	total := db.GetLeaderboardSize(message.Channel, scope)
+	if total == 0 {
+		sendReply(api, message, types.NewReplyf("Nobody is ranked %v yet", scopeName(scope)))
+		return
+	}
+	pages := (total + statsPageSize - 1) / statsPageSize
+	page := 1
+	if args.Has("page") {
+		page = args.Int("page")
+	}
+	if page < 1 || page > pages {
+		sendReply(api, message, types.NewReplyf("There is no page %v, the leaderboard %v has %v", page, scopeName(scope), pluralPages(pages)))
+		return
+	}
+
+	reply := new(types.Reply)
+	reply.Title = "Leaderboard"
+	reply.Color = leaderboardColor
+	offset := (page - 1) * statsPageSize
+	for k, v := range db.GetLeaderboard(message.Channel, scope, offset, statsPageSize, ascending) {
+		name := "unknown"
+		if v.User != nil {
+			name = v.User.Name
+		}
+		// Ranks stay the same whichever way the leaderboard is sorted
+		position := offset + k + 1
+		if ascending {
+			position = total - offset - k
+		}
+		reply.Table = append(reply.Table, []string{"#" + strconv.Itoa(position), name, strconv.Itoa(v.Respec)})
+	}
+	reply.Footer = fmt.Sprintf("Page %v of %v", page, pages)
+	if pages > 1 {
+		reply.Paging = &types.Paging{Page: page, Pages: pages}
+		if page > 1 {
+			reply.Paging.Previous = statsText(args, page-1)
+		}
+		if page < pages {
+			reply.Paging.Next = statsText(args, page+1)
+		}
+	}
+	sendReply(api, message, reply)
+}
+
+// statsText The stats command that shows another page of the same leaderboard
+func statsText(args *Args, page int) string {
+	return CommandText([]string{"stats"}, func(arg Arg) (string, bool) {
+		if arg.Name == "page" {
+			return strconv.Itoa(page), true
+		}
+		return args.String(arg.Name), args.Has(arg.Name)
+	})
+}
+
+// pluralPages How many pages there are, written for a reply
+func pluralPages(pages int) string {
+	if pages == 1 {
+		return "1 page"
+	}
+	return fmt.Sprintf("%v pages", pages)
+}
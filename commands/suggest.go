@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+const (
+	// maxSuggestions The most commands suggested for one that doesn't exist
+	maxSuggestions = 3
+	// maxSuggestionDistance The most letters that can be changed, added, or removed to get a suggested command
+	maxSuggestionDistance = 2
+)
+
+// unknownCommand The reply to a command that doesn't exist, suggesting the commands and aliases closest to it
+func unknownCommand(server *types.Server, name string) *types.Reply {
+	suggestions := suggest(server, name)
+	if len(suggestions) == 0 {
+		return types.NewReplyf("I do not have command `%s`", name)
+	}
+	for k, v := range suggestions {
+		suggestions[k] = "`" + Prefix(server) + v + "`"
+	}
+	return types.NewReplyf("I do not have command `%s`. Did you mean %v?", name, strings.Join(suggestions, " or "))
+}
+
+// suggest The commands and aliases in the server closest to name, closest first
+func suggest(server *types.Server, name string) []string {
+	var names []string
+	for k := range Commands() {
+		names = append(names, k)
+	}
+	if server != nil {
+		for _, v := range db.GetServerAliases(server) {
+			names = append(names, v.Name)
+		}
+	}
+
+	// Short names are only a couple of letters from almost anything, so they need to be closer
+	limit := maxSuggestionDistance
+	if len([]rune(name)) <= 3 {
+		limit = 1
+	}
+	distances := make(map[string]int)
+	var suggestions []string
+	for _, v := range names {
+		if d := editDistance(name, v); d <= limit {
+			if _, ok := distances[v]; !ok {
+				suggestions = append(suggestions, v)
+			}
+			distances[v] = d
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// editDistance How many letters have to be changed, added, or removed to turn a into b. Swapping two letters next to
+// each other counts as one change
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] is the distance between the first i letters of s and the first j letters of t
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"stats", "stats", 0},
+		{"stast", "stats", 1},
+		{"stat", "stats", 1},
+		{"sttas", "stats", 1},
+		{"", "card", 4},
+		{"hlep", "help", 1},
+		{"tiers", "roles", 4},
+		{"übung", "ubung", 1},
+	}
+	for _, v := range tests {
+		if d := editDistance(v.a, v.b); d != v.distance {
+			t.Errorf("Distance from %q to %q is %v, expected %v", v.a, v.b, d, v.distance)
+		}
+	}
+
+	if s := suggest(nil, "lnik"); len(s) == 0 || s[0] != "link" {
+		t.Errorf("Unexpected suggestions: %v", s)
+	}
+	if s := suggest(nil, "xyzzy"); len(s) != 0 {
+		t.Errorf("Unexpected suggestions: %v", s)
+	}
+}
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// tierRules The rules a tier can be added with
+var tierRules = []string{string(types.TierTop), string(types.TierPercentile), string(types.TierShare), string(types.TierScore), string(types.TierRank)}
+
+// cmdTiers List the tiers of roles given out in the server
+func cmdTiers(api types.API, message *types.Message, args *Args) {
+	sendReply(api, message, tiersReply(db.GetServerTiers(message.Channel.Server)))
+}
+
+// cmdTiersAdd Add a tier after the server's other tiers
+func cmdTiersAdd(api types.API, message *types.Message, args *Args) {
+	rule := []string{args.String("rule"), args.String("limit")}
+	if args.Has("highest") {
+		rule = append(rule, args.String("highest"))
+	}
+	ruleName, min, max, err := types.ParseTierRule(rule)
+	if err != nil {
+		sendReply(api, message, types.NewReply(err.Error()))
+		return
+	}
+	name := strings.TrimSpace(args.String("name"))
+	if name == "" {
+		sendReply(api, message, types.NewReply("The tier needs a name"))
+		return
+	}
+
+	tiers := db.GetServerTiers(message.Channel.Server)
+	for _, v := range tiers {
+		if strings.EqualFold(v.Name, name) {
+			sendReply(api, message, types.NewReplyf("There is already a tier named %v", v.Name))
+			return
+		}
+	}
+	setTiers(api, message, append(tiers, &types.Tier{Name: name, Rule: ruleName, Min: min, Max: max}))
+}
+
+// cmdTiersRemove Remove the tier at a position
+func cmdTiersRemove(api types.API, message *types.Message, args *Args) {
+	tiers := db.GetServerTiers(message.Channel.Server)
+	position, ok := tierIndex(api, message, tiers, args.Int("position"))
+	if !ok {
+		return
+	}
+	setTiers(api, message, append(tiers[:position], tiers[position+1:]...))
+}
+
+// cmdTiersMove Move the tier at a position to another position
+func cmdTiersMove(api types.API, message *types.Message, args *Args) {
+	tiers := db.GetServerTiers(message.Channel.Server)
+	from, ok := tierIndex(api, message, tiers, args.Int("position"))
+	if !ok {
+		return
+	}
+	to, ok := tierIndex(api, message, tiers, args.Int("new position"))
+	if !ok {
+		return
+	}
+	tier := tiers[from]
+	tiers = append(tiers[:from], tiers[from+1:]...)
+	tiers = append(tiers[:to], append([]*types.Tier{tier}, tiers[to:]...)...)
+	setTiers(api, message, tiers)
+}
+
+// cmdTiersReset Go back to the default tiers
+func cmdTiersReset(api types.API, message *types.Message, args *Args) {
+	server := message.Channel.Server
+	old := db.GetServerTiers(server)
+	if err := db.ResetServerTiers(server); err != nil {
+		sendReply(api, message, types.NewReply("Could not reset the tiers"))
+		return
+	}
+	tiersChanged(api, server, old)
+	sendReply(api, message, tiersReply(db.GetServerTiers(server)))
+}
+
+func setTiers(api types.API, message *types.Message, tiers []*types.Tier) {
+	server := message.Channel.Server
+	old := db.GetServerTiers(server)
+	if err := db.SetServerTiers(server, tiers); err != nil {
+		sendReply(api, message, types.NewReply("Could not save the tiers"))
+		return
+	}
+	tiersChanged(api, server, old)
+	sendReply(api, message, tiersReply(db.GetServerTiers(server)))
+}
+
+// tiersChanged Tell the API which of the old tiers are gone, so their roles are taken off members and the new ones are given out
+func tiersChanged(api types.API, server *types.Server, old []*types.Tier) {
+	tierAPI, ok := api.(types.TierAPI)
+	if !ok {
+		return
+	}
+	current := make(map[string]bool)
+	for _, v := range db.GetServerTiers(server) {
+		current[v.Name] = true
+	}
+	var removed []string
+	for _, v := range old {
+		if !current[v.Name] {
+			removed = append(removed, v.Name)
+		}
+	}
+	tierAPI.TiersChanged(server, removed)
+}
+
+// tierIndex The index of the tier at the position, replying if there is no tier there
+func tierIndex(api types.API, message *types.Message, tiers []*types.Tier, position int) (int, bool) {
+	if position < 1 || position > len(tiers) {
+		sendReply(api, message, types.NewReplyf("There is no tier at position %v", position))
+		return 0, false
+	}
+	return position - 1, true
+}
+
+func tiersReply(tiers []*types.Tier) *types.Reply {
+	reply := new(types.Reply)
+	reply.Title = "Tiers"
+	if len(tiers) == 0 {
+		reply.Text = "No tiers are set"
+		return reply
+	}
+	for _, v := range tiers {
+		reply.Table = append(reply.Table, []string{strconv.Itoa(v.Position), v.Name, v.RuleString()})
+	}
+	return reply
+}
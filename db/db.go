@@ -48,6 +48,9 @@ func Setup(dbFileName string) error {
 	}
 	logging.Log("SQLite file setup at", dbFile)
 
+	// SQLite only allows one writer at a time, and every API shares this database
+	db.DB().SetMaxOpenConns(1)
+
 	createTables(db)
 
 	//db.LogMode(true)
@@ -55,6 +58,11 @@ func Setup(dbFileName string) error {
 	return err
 }
 
+// Close Close the connection to the database
+func Close() error {
+	return db.Close()
+}
+
 // DeleteDB Delete the database file specified by the given name
 func DeleteDB(dbFileName string) error {
 	configDir := configdir.New(vendorName, projectName)
@@ -72,22 +80,9 @@ func Purge() error {
 	return os.RemoveAll(fileDir.Path)
 }
 
+// createTables Create any missing tables and add any missing columns to existing ones
 func createTables(d *gorm.DB) {
-	if !d.HasTable(&types.User{}) {
-		d.CreateTable(&types.User{})
-	}
-	if !d.HasTable(&types.Channel{}) {
-		d.CreateTable(&types.Channel{})
-	}
-	if !d.HasTable(&types.Server{}) {
-		d.CreateTable(&types.Server{})
-	}
-	if !d.HasTable(&types.Message{}) {
-		d.CreateTable(&types.Message{})
-	}
-	if !d.HasTable(&types.Respec{}) {
-		d.CreateTable(&types.Respec{})
-	}
+	d.AutoMigrate(&types.User{}, &types.Channel{}, &types.Server{}, &types.Message{}, &types.Respec{}, &types.LinkCode{}, &types.Tier{}, &types.Alias{}, &types.RespecChange{}, &types.Reaction{})
 }
 
 // GetTotalRespec Gets the total positive respec in every server combined
@@ -142,7 +137,7 @@ func GetGlobalUsers() []*types.User {
 // GetLocalRespec Gets the respec of every user in the given channel
 func GetLocalRespec(channel *types.Channel) []*types.Respec {
 	var respec []*types.Respec
-	if err := db.Preload("User").Preload("Channel").Preload("Channel.Server").Order("respec DESC").Where("channel_key = ?", channel.Key).Find(&respec).Error; err != nil {
+	if err := db.Preload("User").Preload("Channel").Preload("Channel.Server").Order("respec DESC, user_key").Where("channel_key = ?", channel.Key).Find(&respec).Error; err != nil {
 		return nil
 	}
 	return respec
@@ -151,21 +146,96 @@ func GetLocalRespec(channel *types.Channel) []*types.Respec {
 // GetServerRespec Gets the respec of every user in the given server
 func GetServerRespec(server *types.Server) []*types.Respec {
 	var respec []*types.Respec
-	if err := db.Preload("User").Preload("Channel").Preload("Channel.Server").Group("user_key").Order("respec DESC").Select("key, user_key,channel_key,updated_at, sum(respec) as respec").Where("channel_key IN (?)", db.Table("channels").Where("server_key = ?", server.Key).Select("key").QueryExpr()).Find(&respec).Error; err != nil {
+	if err := db.Preload("User").Preload("Channel").Preload("Channel.Server").Group("user_key").Order("respec DESC, user_key").Select("key, user_key,channel_key,updated_at, sum(respec) as respec").Where("channel_key IN (?)", db.Table("channels").Where("server_key = ?", server.Key).Select("key").QueryExpr()).Find(&respec).Error; err != nil {
 		return nil
 	}
 	return respec
 }
 
-// GetGlobalRespec Gets the respec of every user in every server
+// identityColumn The identity a respec row belongs to, for queries joining respecs to users
+const identityColumn = "COALESCE(NULLIF(users.identity_key, 0), users.key)"
+
+// GetGlobalRespec Gets the respec of every identity in every server. Linked accounts are combined under the account they were linked to
 func GetGlobalRespec() []*types.Respec {
 	var respec []*types.Respec
-	if err := db.Preload("User").Preload("Channel").Preload("Channel.Server").Group("user_key").Order("respec DESC").Select("key, user_key,channel_key,updated_at, sum(respec) as respec").Find(&respec).Error; err != nil {
+	if err := db.Preload("User").Table("respecs").Joins("JOIN users ON users.key = respecs.user_key").Group(identityColumn).Order("respec DESC, user_key").Select(identityColumn + " as user_key, sum(respecs.respec) as respec").Find(&respec).Error; err != nil {
 		return nil
 	}
 	return respec
 }
 
+// leaderboard The respec of everyone in the scope around the given channel, as a query with user_key and respec columns.
+// Global respec is combined under the identity of linked accounts
+func leaderboard(channel *types.Channel, scope types.Scope) *gorm.SqlExpr {
+	switch scope {
+	case types.Local:
+		return db.Table("respecs").Select("user_key, respec").Where("channel_key = ?", channel.Key).QueryExpr()
+	case types.Guild:
+		return db.Table("respecs").Select("user_key, sum(respec) as respec").Where("channel_key IN (?)", db.Table("channels").Select("key").Where("server_key = ?", channel.Server.Key).QueryExpr()).Group("user_key").QueryExpr()
+	}
+	return db.Table("respecs").Joins("JOIN users ON users.key = respecs.user_key").Select(identityColumn + " as user_key, sum(respecs.respec) as respec").Group(identityColumn).QueryExpr()
+}
+
+// GetRank Gets the position of the given user on the leaderboard of the scope, how many are on it, and the user's respec.
+// The rank is 0 if the user isn't on it. Users with the same respec are ranked by who was seen first
+func GetRank(user *types.User, channel *types.Channel, scope types.Scope) (rank, total, respec int) {
+	board := leaderboard(channel, scope)
+	key := user.Key
+	if scope == types.Global {
+		key = user.Identity()
+	}
+
+	total = GetLeaderboardSize(channel, scope)
+	var own []types.Respec
+	if err := db.Raw("SELECT user_key, respec FROM (?) AS board WHERE user_key = ?", board, key).Scan(&own).Error; err != nil || len(own) == 0 {
+		return 0, total, 0
+	}
+	respec = own[0].Respec
+	if err := db.Raw("SELECT count(*) FROM (?) AS board WHERE respec > ? OR (respec = ? AND user_key < ?)", board, respec, respec, key).Row().Scan(&rank); err != nil {
+		return 0, total, respec
+	}
+	return rank + 1, total, respec
+}
+
+// GetLeaderboardSize Gets how many users are on the leaderboard of the scope around the given channel
+func GetLeaderboardSize(channel *types.Channel, scope types.Scope) int {
+	var total int
+	if err := db.Raw("SELECT count(*) FROM (?) AS board", leaderboard(channel, scope)).Row().Scan(&total); err != nil {
+		return 0
+	}
+	return total
+}
+
+// GetLeaderboard Gets part of the leaderboard of the scope around the given channel, starting after 'offset' users.
+// Users are ordered the way they are ranked, or the opposite way if ascending
+func GetLeaderboard(channel *types.Channel, scope types.Scope, offset, limit int, ascending bool) []*types.Respec {
+	var respec []*types.Respec
+	order := "respec DESC, user_key"
+	if ascending {
+		order = "respec, user_key DESC"
+	}
+	if err := db.Raw("SELECT user_key, respec FROM (?) AS board ORDER BY "+order+" LIMIT ? OFFSET ?", leaderboard(channel, scope), limit, offset).Scan(&respec).Error; err != nil {
+		return nil
+	}
+
+	var keys []uint
+	for _, v := range respec {
+		keys = append(keys, v.UserKey)
+	}
+	var users []*types.User
+	if len(keys) > 0 {
+		db.Where("key IN (?)", keys).Find(&users)
+	}
+	byKey := make(map[uint]*types.User)
+	for _, v := range users {
+		byKey[v.Key] = v
+	}
+	for _, v := range respec {
+		v.User = byKey[v.UserKey]
+	}
+	return respec
+}
+
 // GetUserLocalRespec Gets the total respec of a given user in the given channel
 func GetUserLocalRespec(user *types.User, channel *types.Channel) int {
 	var respec types.Respec
@@ -178,12 +248,54 @@ func GetUserLocalRespec(user *types.User, channel *types.Channel) int {
 // GetUserServerRespec Gets the total respec of a given user in the given server
 func GetUserServerRespec(user *types.User, server *types.Server) int {
 	var respec []*types.Respec
-	if err := db.Group("user_key").Select("user_key, sum(respec) as respec").Where("user_key = ? AND channel_key IN (?)", user.Key, db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).Find(&respec).Error; err != nil {
+	if err := db.Group("user_key").Select("user_key, sum(respec) as respec").Where("user_key = ? AND channel_key IN (?)", user.Key, db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).Find(&respec).Error; err != nil || len(respec) == 0 {
 		return 0
 	}
 	return respec[0].Respec
 }
 
+// GetUserGlobalRespec Gets the total respec of the given user's identity in every server, including linked accounts
+func GetUserGlobalRespec(user *types.User) int {
+	var total []types.Respec
+	if err := db.Table("respecs").Joins("JOIN users ON users.key = respecs.user_key").Where(identityColumn+" = ?", user.Identity()).Select("sum(respecs.respec) as respec").Scan(&total).Error; err != nil || len(total) == 0 {
+		return 0
+	}
+	return total[0].Respec
+}
+
+// NewRespecChange Record respec a user gained or lost
+func NewRespecChange(change *types.RespecChange) {
+	db.Create(change)
+}
+
+// NewReaction Store a reaction so it can be taken back by its ID
+func NewReaction(reaction *types.Reaction) error {
+	if reaction.Author == nil {
+		return fmt.Errorf("Author not set")
+	}
+	reaction.AuthorKey = reaction.Author.Key
+	return db.Create(reaction).Error
+}
+
+// TakeReaction Remove the reaction with the given ID on the given API and return it. Returns nil if it isn't stored
+func TakeReaction(reactionID, APIID string) *types.Reaction {
+	var reaction types.Reaction
+	if err := db.Preload("Author").Where("id = ? AND api_id = ?", reactionID, APIID).First(&reaction).Error; err != nil {
+		return nil
+	}
+	db.Delete(&reaction)
+	return &reaction
+}
+
+// GetUserRespecChange Gets the respec the given user gained or lost in the given server since the given time
+func GetUserRespecChange(user *types.User, server *types.Server, since time.Time) int {
+	var total []types.RespecChange
+	if err := db.Model(&types.RespecChange{}).Where("user_key = ? AND time > ? AND channel_key IN (?)", user.Key, since, db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).Select("sum(amount) as amount").Scan(&total).Error; err != nil || len(total) == 0 {
+		return 0
+	}
+	return total[0].Amount
+}
+
 // GetLastRespecTime Get's the time.Time of the last time a given users respec was updated in the given channel
 func GetLastRespecTime(user *types.User, channel *types.Channel) *time.Time {
 	var respec types.Respec
@@ -201,7 +313,7 @@ func AddRespec(respec *types.Respec) {
 // GetServerTopUser Gets the top user in the given server
 func GetServerTopUser(server *types.Server) *types.User {
 	var respec types.Respec
-	if err := db.Preload("User").Group("user_key").Order("respec DESC").Select("user_key, sum(respec) as respec").Where("channel_key IN (?)", db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).First(&respec).Error; err != nil {
+	if err := db.Preload("User").Group("user_key").Order("respec DESC, user_key").Select("user_key, sum(respec) as respec").Where("channel_key IN (?)", db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).First(&respec).Error; err != nil {
 		return nil
 	}
 	return respec.User
@@ -318,6 +430,72 @@ func GetUser(UserID, APIID string) *types.User {
 	return &user
 }
 
+// GetLinkedUsers Get every account linked to the same identity as the given user, including the user
+func GetLinkedUsers(user *types.User) []*types.User {
+	var users []*types.User
+	if err := db.Where("COALESCE(NULLIF(identity_key, 0), key) = ?", user.Identity()).Order("key").Find(&users).Error; err != nil {
+		return nil
+	}
+	return users
+}
+
+// NewLinkCode Store a link code issued by its user, replacing any code they issued before
+func NewLinkCode(code *types.LinkCode) error {
+	if code.Code == "" {
+		return fmt.Errorf("Code not set")
+	}
+	if code.User == nil {
+		return fmt.Errorf("User not set")
+	}
+	code.UserKey = code.User.Key
+	db.Where("user_key = ?", code.UserKey).Delete(types.LinkCode{})
+	return db.Create(code).Error
+}
+
+// RedeemLinkCode Link the identity of the given user to the identity of the user who issued the code.
+// Returns the issuing user
+func RedeemLinkCode(code string, user *types.User) (*types.User, error) {
+	var linkCode types.LinkCode
+	if err := db.Preload("User").Where("code = ? AND expires > ?", code, time.Now()).First(&linkCode).Error; err != nil {
+		return nil, fmt.Errorf("Link code not found or expired")
+	}
+	issuer := linkCode.User
+	if issuer.APIID == user.APIID {
+		return nil, fmt.Errorf("Link codes must be used on a different platform than the one they came from")
+	}
+	if issuer.Identity() == user.Identity() {
+		return nil, fmt.Errorf("Accounts are already linked")
+	}
+
+	err := db.Model(&types.User{}).Where("COALESCE(NULLIF(identity_key, 0), key) = ?", user.Identity()).Update("identity_key", issuer.Identity()).Error
+	if err != nil {
+		return nil, err
+	}
+	db.Delete(&linkCode)
+	user.IdentityKey = issuer.Identity()
+	return issuer, nil
+}
+
+// UnlinkUser Give the user their own identity again. Any accounts linked to them stay linked to each other
+func UnlinkUser(user *types.User) error {
+	identity := user.Identity()
+	if err := db.Model(user).Update("identity_key", 0).Error; err != nil {
+		return err
+	}
+	user.IdentityKey = 0
+	if identity != user.Key {
+		return nil
+	}
+
+	// The identity belonged to this account, so it moves to the oldest remaining account
+	var remaining []*types.User
+	db.Where("identity_key = ? AND key != ?", identity, user.Key).Order("key").Find(&remaining)
+	if len(remaining) == 0 {
+		return nil
+	}
+	return db.Model(&types.User{}).Where("identity_key = ? AND key != ?", identity, user.Key).Update("identity_key", remaining[0].Key).Error
+}
+
 // NewChannel Insert the channel into the database. Fills the 'Key' field
 func NewChannel(channel *types.Channel) {
 	if db.NewRecord(channel) {
@@ -355,6 +533,103 @@ func GetServer(serverID, APIID string) *types.Server {
 	return &server
 }
 
+// GetServerTiers Get the tiers of the given server in order, or the default tiers if it hasn't set its own
+func GetServerTiers(server *types.Server) []*types.Tier {
+	var stored types.Server
+	if err := db.Where("key = ?", server.Key).First(&stored).Error; err != nil || !stored.CustomTiers {
+		return types.DefaultTiers()
+	}
+	var tiers []*types.Tier
+	if err := db.Where("server_key = ?", server.Key).Order("position").Find(&tiers).Error; err != nil {
+		return nil
+	}
+	return tiers
+}
+
+// SetServerTiers Replace the tiers of the given server. Tiers are numbered in the order given
+func SetServerTiers(server *types.Server, tiers []*types.Tier) error {
+	tx := db.Begin()
+	if err := tx.Where("server_key = ?", server.Key).Delete(types.Tier{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for k, v := range tiers {
+		tier := *v
+		tier.Key = 0
+		tier.Server = nil
+		tier.ServerKey = server.Key
+		tier.Position = k + 1
+		if err := tx.Create(&tier).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Model(&types.Server{}).Where("key = ?", server.Key).Update("custom_tiers", true).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	server.CustomTiers = true
+	return tx.Commit().Error
+}
+
+// ResetServerTiers Delete the tiers of the given server so it uses the default ones again
+func ResetServerTiers(server *types.Server) error {
+	tx := db.Begin()
+	if err := tx.Where("server_key = ?", server.Key).Delete(types.Tier{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&types.Server{}).Where("key = ?", server.Key).Update("custom_tiers", false).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	server.CustomTiers = false
+	return tx.Commit().Error
+}
+
+// UpdateServerPrefix Store the command prefix of the given server
+func UpdateServerPrefix(server *types.Server) error {
+	return db.Model(&types.Server{}).Where("key = ?", server.Key).Update("prefix", server.Prefix).Error
+}
+
+// UpdateServerIgnoreUnknown Store whether unknown commands get a reply in the given server
+func UpdateServerIgnoreUnknown(server *types.Server) error {
+	return db.Model(&types.Server{}).Where("key = ?", server.Key).Update("ignore_unknown", server.IgnoreUnknown).Error
+}
+
+// GetServerAliases Get every alias in the given server, ordered by name
+func GetServerAliases(server *types.Server) []*types.Alias {
+	var aliases []*types.Alias
+	if err := db.Where("server_key = ?", server.Key).Order("name").Find(&aliases).Error; err != nil {
+		return nil
+	}
+	return aliases
+}
+
+// GetServerAlias Get the alias with the given name in the given server
+func GetServerAlias(server *types.Server, name string) *types.Alias {
+	var alias types.Alias
+	if err := db.Where("server_key = ? AND name = ?", server.Key, name).First(&alias).Error; err != nil {
+		return nil
+	}
+	return &alias
+}
+
+// SetServerAlias Store the alias, replacing any alias with the same name in its server
+func SetServerAlias(alias *types.Alias) error {
+	if alias.Server == nil {
+		return fmt.Errorf("Server not set")
+	}
+	alias.ServerKey = alias.Server.Key
+	db.Where("server_key = ? AND name = ?", alias.ServerKey, alias.Name).Delete(types.Alias{})
+	return db.Create(alias).Error
+}
+
+// DeleteServerAlias Delete the alias with the given name in the given server. Returns false if there was no such alias
+func DeleteServerAlias(server *types.Server, name string) bool {
+	return db.Where("server_key = ? AND name = ?", server.Key, name).Delete(types.Alias{}).RowsAffected > 0
+}
+
 // NewMessage Insert the given message into the database. Fills the 'Key' field
 func NewMessage(message *types.Message) {
 	if db.NewRecord(message) {
@@ -371,6 +646,15 @@ func GetLastMessage(user *types.User, channel *types.Channel) *types.Message {
 	return &message
 }
 
+// GetUserLastServerMessage Get the last message by the given user posted anywhere in the given server
+func GetUserLastServerMessage(user *types.User, server *types.Server) *types.Message {
+	var message types.Message
+	if err := db.Where("user_key = ? AND channel_key IN (?)", user.Key, db.Table("channels").Select("key").Where("server_key = ?", server.Key).QueryExpr()).Order("time DESC").First(&message).Error; err != nil {
+		return nil
+	}
+	return &message
+}
+
 // GetUserLastMessages Get the last 'amount' messages by the given user posted in the given channel
 func GetUserLastMessages(user *types.User, channel *types.Channel, amount int) []*types.Message {
 	var messages []*types.Message
@@ -103,6 +103,25 @@ func TestDB(t *testing.T) {
 	respec2.Respec = -50
 	AddRespec(respec2)
 
+	if rank, total, respec := GetRank(user2, channel, types.Guild); rank != 2 || total != 2 || respec != -50 {
+		t.Errorf("Expected rank 2 of 2 with -50 respec, got %v of %v with %v", rank, total, respec)
+	}
+	if rank, total, _ := GetRank(user2, channel, types.Local); rank != 0 || total != 1 {
+		t.Errorf("User ranked in a channel they have no respec in: %v of %v", rank, total)
+	}
+	if rank, _, _ := GetRank(user, channel, types.Global); rank != 1 {
+		t.Errorf("Expected global rank 1, got %v", rank)
+	}
+	if board := GetLeaderboard(channel, types.Guild, 1, 5, false); len(board) != 1 || board[0].User == nil || board[0].User.Key != user2.Key {
+		t.Errorf("Unexpected leaderboard %+v", board)
+	}
+	if board := GetLeaderboard(channel, types.Guild, 0, 1, true); len(board) != 1 || board[0].Respec != -50 {
+		t.Errorf("Unexpected ascending leaderboard %+v", board)
+	}
+	if size := GetLeaderboardSize(channel, types.Guild); size != 2 {
+		t.Errorf("Expected 2 users on the leaderboard, got %v", size)
+	}
+
 	GetLocalRespec(channel)
 
 	GetServerRespec(server)
@@ -178,9 +197,121 @@ func TestDB(t *testing.T) {
 		t.Error("Message should be unique")
 	}
 
+	NewRespecChange(&types.RespecChange{UserKey: user.Key, ChannelKey: channel.Key, Amount: 5, Time: time.Now().Add(-time.Hour)})
+	NewRespecChange(&types.RespecChange{UserKey: user.Key, ChannelKey: channel.Key, Amount: -2, Time: time.Now()})
+	if change := GetUserRespecChange(user, server, time.Now().Add(-2*time.Hour)); change != 3 {
+		t.Errorf("Expected a change of 3, got %v", change)
+	}
+	if change := GetUserRespecChange(user, server, time.Now().Add(-time.Minute)); change != -2 {
+		t.Errorf("Expected a change of -2, got %v", change)
+	}
+	if respec := GetUserGlobalRespec(user); respec != GetUserServerRespec(user, server) {
+		t.Errorf("Global respec %v does not match server respec %v", respec, GetUserServerRespec(user, server))
+	}
+	if last := GetUserLastServerMessage(user, server); last == nil || last.UserKey != user.Key {
+		t.Errorf("Unexpected last message %+v", last)
+	}
+
+	if err := NewReaction(&types.Reaction{ID: "reactionid", APIID: "test", GiverID: "giverid", Author: user, ChannelKey: channel.Key, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if r := TakeReaction("reactionid", "other"); r != nil {
+		t.Error("Reaction taken from the wrong api")
+	}
+	if r := TakeReaction("reactionid", "test"); r == nil || r.GiverID != "giverid" || r.Author == nil || r.Author.Key != user.Key {
+		t.Errorf("Unexpected reaction %+v", r)
+	}
+	if r := TakeReaction("reactionid", "test"); r != nil {
+		t.Error("Reaction taken twice")
+	}
+
 	db.Close()
 	err = DeleteDB("test.db")
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestIdentity(t *testing.T) {
+	err := Setup("identitytest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []*types.User
+	var channels []*types.Channel
+	amounts := []int{10, 20, 5}
+	for k, v := range []string{"discord", "irc", "matrix"} {
+		user := &types.User{ID: "user", Name: "user-" + v, APIID: v}
+		NewUser(user)
+		server := &types.Server{ID: "server", APIID: v}
+		NewServer(server)
+		channel := &types.Channel{ID: "chan", APIID: v, Server: server, ServerKey: server.Key}
+		NewChannel(channel)
+		AddRespec(&types.Respec{User: user, Channel: channel, Respec: amounts[k]})
+		users = append(users, user)
+		channels = append(channels, channel)
+	}
+
+	if len(GetGlobalStats()) != 3 {
+		t.Error("Unlinked users were combined")
+	}
+
+	code := &types.LinkCode{Code: "CODE1", User: users[0], Expires: time.Now().Add(time.Minute)}
+	if err = NewLinkCode(code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RedeemLinkCode("CODE1", users[0]); err == nil {
+		t.Error("Link code redeemed on the platform it was issued on")
+	}
+	issuer, err := RedeemLinkCode("CODE1", users[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer.Key != users[0].Key || users[1].Identity() != users[0].Key {
+		t.Error("Redeemed code did not link to the issuer")
+	}
+	if _, err = RedeemLinkCode("CODE1", users[2]); err == nil {
+		t.Error("Link code redeemed twice")
+	}
+
+	expired := &types.LinkCode{Code: "CODE2", User: users[2], Expires: time.Now().Add(-time.Minute)}
+	NewLinkCode(expired)
+	if _, err = RedeemLinkCode("CODE2", users[0]); err == nil {
+		t.Error("Expired link code redeemed")
+	}
+
+	stats := GetGlobalStats()
+	if len(stats) != 2 || stats[0].Key != "user-discord" || stats[0].Value != 30 {
+		t.Errorf("Linked users not combined in global stats: %+v", stats)
+	}
+	if local := GetLocalStats(channels[1]); len(local) != 1 || local[0].Value != 20 {
+		t.Errorf("Local stats changed by linking: %+v", local)
+	}
+	if len(GetLinkedUsers(users[1])) != 2 {
+		t.Error("Linked users not found")
+	}
+
+	// Unlinking the account the identity belongs to leaves the others linked to each other
+	code = &types.LinkCode{Code: "CODE3", User: users[1], Expires: time.Now().Add(time.Minute)}
+	NewLinkCode(code)
+	if _, err = RedeemLinkCode("CODE3", users[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err = UnlinkUser(users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(GetLinkedUsers(users[0])) != 1 || len(GetLinkedUsers(GetUser("user", "matrix"))) != 2 {
+		t.Error("Unlinking did not keep the remaining accounts linked")
+	}
+	stats = GetGlobalStats()
+	if len(stats) != 2 || stats[0].Key != "user-irc" || stats[0].Value != 25 {
+		t.Errorf("Global stats wrong after unlinking: %+v", stats)
+	}
+
+	db.Close()
+	err = DeleteDB("identitytest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
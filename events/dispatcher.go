@@ -0,0 +1,101 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/commands"
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
+	"github.com/Jaggernaut555/respecbot-v2/rate"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// Dispatcher Decides what happens for every event on an API, so rating, commands, and roles behave the same on every platform
+type Dispatcher struct {
+	api   types.API
+	roles *roleCache
+}
+
+// NewDispatcher Create a dispatcher for events that happen on the given API
+func NewDispatcher(a types.API) *Dispatcher {
+	d := new(Dispatcher)
+	d.api = a
+	d.roles = newRoleCache()
+	return d
+}
+
+// Dispatch Handle a single event
+func (d *Dispatcher) Dispatch(event Event) {
+	switch e := event.(type) {
+	case MessageCreated:
+		d.messageCreated(e)
+	case ReactionAdded:
+		logging.Log(e.String())
+		d.reaction(e.GiverID, e.Author, e.Channel, rate.OtherValue, e.Time)
+	case ReactionRemoved:
+		logging.Log(e.String())
+		d.reaction(e.GiverID, e.Author, e.Channel, -rate.OtherValue, e.Time)
+	case MemberJoined:
+		logging.Log(e.String())
+		d.updateServerStatus(e.Server)
+	case ServerJoined:
+		logging.Log(e.String())
+		d.roles.forgetServer(e.Server)
+		d.setupRoles(e.Server)
+		d.updateServerStatus(e.Server)
+	case MemberUpdated:
+		d.roles.set(e.Server, e.User, e.Roles)
+	case RolesChanged:
+		logging.Log(e.String())
+		d.roles.forgetServer(e.Server)
+	case TiersChanged:
+		logging.Log(e.String())
+		d.dropRoles(e.Server, e.Removed)
+		d.setupRoles(e.Server)
+		d.updateServerStatus(e.Server)
+	}
+}
+
+func (d *Dispatcher) messageCreated(e MessageCreated) {
+	msg := e.Message
+	// Mentioning the bot works as a prefix everywhere
+	prefix := commands.Prefix(msg.Channel.Server)
+	if msg.Addressed || strings.HasPrefix(msg.Content, prefix) {
+		msg.Content = strings.TrimPrefix(msg.Content, prefix)
+		d.api.HandleCommand(msg)
+		return
+	}
+
+	// rate users on everything else they get
+	if msg.Channel.Active {
+		rate.RespecMessage(msg)
+		db.NewMessage(msg)
+		d.updateServerStatus(msg.Channel.Server)
+	}
+}
+
+// reaction Respec the author of a message someone else reacted to
+func (d *Dispatcher) reaction(giverID string, author *types.User, channel *types.Channel, rating int, at time.Time) {
+	if channel.Active && giverID != author.ID {
+		rate.RespecOther(author, channel, rating, at)
+		d.updateServerStatus(channel.Server)
+	}
+}
+
+// updateServerStatus Give every user in the server the roles of the server's tiers they are in, if the API has roles.
+// The changes are queued, and a user's changes that haven't been made yet are replaced by the latest ones
+func (d *Dispatcher) updateServerStatus(server *types.Server) {
+	roles, ok := d.api.(types.RoleAPI)
+	if !ok {
+		return
+	}
+
+	tierNames, memberTiers := rate.GetServerTierRoles(server)
+	users := db.GetServerUsers(server)
+
+	for _, v := range users {
+		outbox.Roles.Send(server.APIID+" "+server.ID, v.ID, d.syncRoles(roles, server, v, tierNames, memberTiers[v.Key]))
+	}
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// Event Something that happened on a chat platform. Every API turns its own events into these and gives them to a Dispatcher
+type Event interface {
+	String() string
+}
+
+// MessageCreated A user posted a message
+type MessageCreated struct {
+	Message *types.Message
+}
+
+func (e MessageCreated) String() string {
+	return fmt.Sprintf("Message %v created", e.Message.ID)
+}
+
+// ReactionAdded The user identified by GiverID reacted to a message posted by Author
+type ReactionAdded struct {
+	GiverID string
+	Author  *types.User
+	Channel *types.Channel
+	// Time When the reaction was added
+	Time time.Time
+}
+
+func (e ReactionAdded) String() string {
+	return "Reaction added"
+}
+
+// ReactionRemoved The user identified by GiverID removed their reaction to a message posted by Author
+type ReactionRemoved struct {
+	GiverID string
+	Author  *types.User
+	Channel *types.Channel
+	// Time When the reaction was removed
+	Time time.Time
+}
+
+func (e ReactionRemoved) String() string {
+	return "Reaction removed"
+}
+
+// MemberJoined A user joined a server
+type MemberJoined struct {
+	User   *types.User
+	Server *types.Server
+}
+
+func (e MemberJoined) String() string {
+	return fmt.Sprintf("%v joined server %v", e.User.Name, e.Server.ID)
+}
+
+// MemberUpdated A member's roles in a server changed. Roles has the name of every role they have now
+type MemberUpdated struct {
+	User   *types.User
+	Server *types.Server
+	Roles  []string
+}
+
+func (e MemberUpdated) String() string {
+	return fmt.Sprintf("%v updated in server %v", e.User.Name, e.Server.ID)
+}
+
+// RolesChanged A role in a server was created, renamed, or deleted
+type RolesChanged struct {
+	Server *types.Server
+}
+
+func (e RolesChanged) String() string {
+	return fmt.Sprintf("Roles changed in server %v", e.Server.ID)
+}
+
+// TiersChanged The tiers of a server were changed. Removed has the name of every tier that is gone
+type TiersChanged struct {
+	Server  *types.Server
+	Removed []string
+}
+
+func (e TiersChanged) String() string {
+	return fmt.Sprintf("Tiers changed in server %v", e.Server.ID)
+}
+
+// ServerJoined The bot joined or reconnected to a server
+type ServerJoined struct {
+	Server *types.Server
+}
+
+func (e ServerJoined) String() string {
+	return fmt.Sprintf("Joined server %v", e.Server.ID)
+}
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// roleCache The roles each member of each server is known to have
+type roleCache struct {
+	mu      sync.Mutex
+	servers map[string]map[string]map[string]bool
+}
+
+func newRoleCache() *roleCache {
+	c := new(roleCache)
+	c.servers = make(map[string]map[string]map[string]bool)
+	return c
+}
+
+// get The roles the user has in the server, and whether they are known
+func (c *roleCache) get(server *types.Server, user *types.User) (map[string]bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	roles, ok := c.servers[server.ID][user.ID]
+	if !ok {
+		return nil, false
+	}
+	current := make(map[string]bool, len(roles))
+	for k, v := range roles {
+		current[k] = v
+	}
+	return current, true
+}
+
+// set Remember the roles the user has in the server
+func (c *roleCache) set(server *types.Server, user *types.User, roleNames []string) {
+	roles := make(map[string]bool)
+	for _, v := range roleNames {
+		roles[v] = true
+	}
+	c.setMap(server, user, roles)
+}
+
+func (c *roleCache) setMap(server *types.Server, user *types.User, roles map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.servers[server.ID] == nil {
+		c.servers[server.ID] = make(map[string]map[string]bool)
+	}
+	c.servers[server.ID][user.ID] = roles
+}
+
+// forgetMember Forget the roles of the user in the server, so they are looked up again next time
+func (c *roleCache) forgetMember(server *types.Server, user *types.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.servers[server.ID], user.ID)
+}
+
+// forgetServer Forget the roles of every member of the server
+func (c *roleCache) forgetServer(server *types.Server) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.servers, server.ID)
+}
+
+// setupRoles Queue creating any of the server's tier roles that are missing, logging anything that is misconfigured
+func (d *Dispatcher) setupRoles(server *types.Server) {
+	roles, ok := d.api.(types.RoleAPI)
+	if !ok {
+		return
+	}
+	var roleNames []string
+	for _, v := range db.GetServerTiers(server) {
+		roleNames = append(roleNames, v.Name)
+	}
+	outbox.Roles.Send(server.APIID+" "+server.ID, "", func() error {
+		setup, err := roles.SetupRoles(server, roleNames)
+		if err != nil {
+			return err
+		}
+		for _, v := range setup.Created {
+			logging.Log(fmt.Sprintf("Created role %v in server %v", v, server.ID))
+		}
+		for _, v := range setup.Problems {
+			logging.Log(fmt.Sprintf("Server %v: %v", server.ID, v))
+		}
+		return nil
+	})
+}
+
+// dropRoles Queue taking the named roles, which belonged to tiers that are gone, off every member of the server
+func (d *Dispatcher) dropRoles(server *types.Server, roleNames []string) {
+	roles, ok := d.api.(types.RoleAPI)
+	if !ok || len(roleNames) == 0 {
+		return
+	}
+	for _, v := range db.GetServerUsers(server) {
+		// Not keyed by the user, so their next status update can't replace it
+		outbox.Roles.Send(server.APIID+" "+server.ID, "", d.syncRoles(roles, server, v, roleNames, nil))
+	}
+}
+
+// syncRoles A job that makes only the changes needed for the user to have exactly the desired roles out of the managed ones.
+// Roles that aren't managed are left alone. The user's current roles are looked up from the API if they aren't cached
+func (d *Dispatcher) syncRoles(roles types.RoleAPI, server *types.Server, user *types.User, managed, desired []string) outbox.Job {
+	return func() error {
+		current, ok := d.roles.get(server, user)
+		if !ok {
+			roleNames, err := roles.MemberRoles(server, user)
+			if err != nil {
+				return err
+			}
+			d.roles.set(server, user, roleNames)
+			current, _ = d.roles.get(server, user)
+		}
+
+		want := make(map[string]bool)
+		for _, v := range desired {
+			want[v] = true
+		}
+
+		var err error
+		for _, v := range managed {
+			if want[v] && !current[v] {
+				if e := roles.AddRole(server, user, v); e != nil {
+					err = e
+					continue
+				}
+				current[v] = true
+			} else if !want[v] && current[v] {
+				if e := roles.RemoveRole(server, user, v); e != nil {
+					err = e
+					continue
+				}
+				delete(current, v)
+			}
+		}
+		if err != nil {
+			// Look the roles up again next time, in case a change was made even though it failed
+			d.roles.forgetMember(server, user)
+			return err
+		}
+		d.roles.setMap(server, user, current)
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/Jaggernaut555/respecbot-v2
+
+go 1.22
+
+require (
+	github.com/Shopify/go-lua v0.0.0-20250718183320-1e37f32ad7d0
+	github.com/Shopify/goluago v0.0.0-20240527182001-ec4ec6c26eab
+	github.com/bwmarrin/discordgo v0.24.0
+	github.com/jinzhu/gorm v1.9.16
+	github.com/shibukawa/configdir v0.0.0-20170330084843-e180dbdc8da0
+)
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.0 // indirect
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
+	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+)
@@ -4,29 +4,58 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Jaggernaut555/respecbot-v2/api"
+	"github.com/Jaggernaut555/respecbot-v2/commands"
 	"github.com/Jaggernaut555/respecbot-v2/db"
 	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/outbox"
 	"github.com/Jaggernaut555/respecbot-v2/rate"
 	"github.com/Jaggernaut555/respecbot-v2/types"
 )
 
+// shutdownTimeout How long queued replies and role changes are given to be sent on shutdown
+const shutdownTimeout = 10 * time.Second
+
 // Global vars
 var (
-	token   string
-	apiName string
-	dbName  string
-)
+	token    string
+	apiNames string
+	dbName   string
+	owners   string
 
-var (
-	apiInstance types.API
+	consoleUser    string
+	consoleChannel string
+	consoleServer  string
+
+	ircServer   string
+	ircNick     string
+	ircPass     string
+	ircChannels string
+
+	matrixServer string
+	matrixToken  string
 )
 
 func init() {
-	flag.StringVar(&apiName, "api", "", "description")
-	flag.StringVar(&token, "t", "", "Authentication token")
+	flag.StringVar(&apiNames, "api", "", "Comma separated list of APIs to run the bot on (discord, console, irc, matrix)")
+	flag.StringVar(&token, "t", "", "Discord bot token")
 	flag.StringVar(&dbName, "db", "respecbot-v2.db", "Name of the database file to be used")
+	flag.StringVar(&owners, "owners", "", "Comma separated list of bot owners as api:userID, like discord:1234, matrix:@me:example.org, or irc:$a:account")
+	flag.StringVar(&consoleUser, "user", "console", "Name of the user sending messages with the console api")
+	flag.StringVar(&consoleChannel, "channel", "general", "Name of the channel messages are sent in with the console api")
+	flag.StringVar(&consoleServer, "server", "local", "Name of the server messages are sent in with the console api")
+	flag.StringVar(&ircServer, "ircserver", "", "Address (host:port) of the IRC network to connect to with the irc api")
+	flag.StringVar(&ircNick, "ircnick", "respecbot", "Nick used on IRC")
+	flag.StringVar(&ircPass, "ircpass", "", "Server password used on IRC, if the network needs one")
+	flag.StringVar(&ircChannels, "ircchannels", "", "Comma separated list of IRC channels to join")
+	flag.StringVar(&matrixServer, "matrixserver", "", "URL of the Matrix homeserver to connect to with the matrix api")
+	flag.StringVar(&matrixToken, "matrixtoken", "", "Access token of the bot's Matrix account")
 	purge := flag.Bool("purge", false, "Use this flag to remove all user data associated with this program")
 
 	flag.Parse()
@@ -47,36 +76,118 @@ func init() {
 		os.Exit(1)
 	}
 
+	if err = commands.SetOwners(strings.Split(owners, ",")); err != nil {
+		logging.Err(err)
+		os.Exit(1)
+	}
+
 	rate.InitRatings()
 }
 
 func main() {
-	var err error
-
-	apiInstance, err = selectAPI()
+	apis, err := selectAPIs()
 	if err != nil {
 		logging.Err(err)
 		os.Exit(1)
 	}
 
-	logging.Log("Setting up API")
-	err = apiInstance.Setup()
-	if err != nil {
-		logging.Log("API could not set up")
-		logging.Err(err)
-		os.Exit(1)
+	for _, v := range apis {
+		logging.Log("Setting up API", v.String())
+		err = v.Setup()
+		if err != nil {
+			logging.Log("API could not set up")
+			logging.Err(err)
+			os.Exit(1)
+		}
 	}
-	err = apiInstance.Listen()
-	if err != nil {
+
+	// Every API listens at the same time. Stop them all on a signal or once they have all stopped on their own
+	var wg sync.WaitGroup
+	for _, v := range apis {
+		wg.Add(1)
+		go func(a types.API) {
+			defer wg.Done()
+			if err := a.Listen(); err != nil {
+				logging.Err(err)
+			}
+			logging.Log("API stopped", a.String())
+		}(v)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sc:
+		logging.Log("Shutting down")
+		// Send whatever is still queued before the APIs are closed
+		stopOutbox()
+		for _, v := range apis {
+			if err := v.Close(); err != nil {
+				logging.Err(err)
+			}
+		}
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			logging.Log("Not every API stopped listening")
+		}
+	case <-stopped:
+		stopOutbox()
+	}
+
+	if err = db.Close(); err != nil {
 		logging.Err(err)
 		os.Exit(1)
 	}
 }
 
-func selectAPI() (types.API, error) {
+// stopOutbox Send whatever is still queued, but don't wait on a queue that keeps filling up
+func stopOutbox() {
+	if !outbox.Stop(shutdownTimeout) {
+		logging.Log("Replies and role changes still queued were dropped")
+	}
+}
+
+// selectAPIs Create every API named in the comma separated -api flag
+func selectAPIs() ([]types.API, error) {
+	var apis []types.API
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(apiNames, ",") {
+		name = strings.TrimSpace(name)
+		if selected[name] {
+			return nil, fmt.Errorf("%v api was selected more than once", name)
+		}
+		selected[name] = true
+
+		a, err := selectAPI(name)
+		if err != nil {
+			return nil, err
+		}
+		apis = append(apis, a)
+	}
+	return apis, nil
+}
+
+func selectAPI(apiName string) (types.API, error) {
 	switch apiName {
 	case "discord":
 		return api.NewDiscord(token)
+	case "console":
+		return api.NewConsole(os.Stdin, os.Stdout, consoleUser, consoleChannel, consoleServer)
+	case "irc":
+		var channels []string
+		if ircChannels != "" {
+			channels = strings.Split(ircChannels, ",")
+		}
+		return api.NewIRC(ircServer, ircNick, ircPass, channels)
+	case "matrix":
+		return api.NewMatrix(matrixServer, matrixToken)
 	default:
 		return nil, fmt.Errorf("%v is not a valid api", apiName)
 	}
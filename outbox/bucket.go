@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Bucket A token bucket. Up to burst tokens can be taken at once, after that one more is added every 'every'
+type Bucket struct {
+	every  time.Duration
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket Create a full bucket. An 'every' of 0 or less means there is no limit
+func NewBucket(every time.Duration, burst int) *Bucket {
+	b := new(Bucket)
+	b.every = every
+	b.burst = float64(burst)
+	b.tokens = b.burst
+	b.last = time.Now()
+	return b
+}
+
+// Wait Take a token, sleeping until one is available
+func (b *Bucket) Wait() {
+	time.Sleep(b.Take())
+}
+
+// Take Take a token, and return how long to wait before using it. Tokens can be taken before they are available,
+// and the next one is only available after the wait
+func (b *Bucket) Take() time.Duration {
+	if b.every <= 0 {
+		return 0
+	}
+	b.fill(time.Now())
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(b.every))
+		b.tokens = 0
+		b.last = b.last.Add(wait)
+		return wait
+	}
+	b.tokens--
+	return 0
+}
+
+// UntilFull How long until the bucket is full again
+func (b *Bucket) UntilFull() time.Duration {
+	if b.every <= 0 {
+		return 0
+	}
+	now := time.Now()
+	b.fill(now)
+	return time.Duration((b.burst-b.tokens)*float64(b.every)) - now.Sub(b.last)
+}
+
+// fill Add the tokens that have become available since the last time
+func (b *Bucket) fill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.every)
+		b.last = now
+	}
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
@@ -0,0 +1,214 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Jaggernaut555/respecbot-v2/logging"
+	"github.com/Jaggernaut555/respecbot-v2/queue"
+)
+
+// Job Something sent to an API, like a reply or a role change
+type Job func() error
+
+// Replies Queue for replies, one lane per channel
+var Replies = NewQueue(time.Second, 5)
+
+// Roles Queue for role changes, one lane per server
+var Roles = NewQueue(time.Second, 10)
+
+// Queue Runs jobs in the background in the order they were sent. Every lane has its own token bucket,
+// so one busy channel or server can't hold up the others
+type Queue struct {
+	mu    sync.Mutex
+	idle  *sync.Cond
+	every time.Duration
+	burst int
+	// lanes Every lane with jobs, or whose bucket hasn't filled up again since its last job
+	lanes map[string]*lane
+	// pending Jobs that have been sent but not finished
+	pending int
+	stopped chan struct{}
+}
+
+type lane struct {
+	id      string
+	jobs    *queue.ListQueue
+	keys    map[string]*queue.Node
+	bucket  *Bucket
+	running bool
+}
+
+type keyedJob struct {
+	key string
+	job Job
+}
+
+// NewQueue Create a queue where each lane can run burst jobs at once and one more every 'every'.
+// An 'every' of 0 or less means there is no limit
+func NewQueue(every time.Duration, burst int) *Queue {
+	q := new(Queue)
+	q.idle = sync.NewCond(&q.mu)
+	q.every = every
+	q.burst = burst
+	q.lanes = make(map[string]*lane)
+	q.stopped = make(chan struct{})
+	return q
+}
+
+// Send Add the job to the end of the lane. If key is not "" and a job with the same key is still waiting in the lane,
+// that job is replaced instead, so only the latest one runs
+func (q *Queue) Send(laneID, key string, job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.isStopped() {
+		return
+	}
+
+	l := q.lanes[laneID]
+	if l == nil {
+		l = new(lane)
+		l.id = laneID
+		l.jobs = queue.NewListQueue(&keyedJob{})
+		l.keys = make(map[string]*queue.Node)
+		l.bucket = NewBucket(q.every, q.burst)
+		q.lanes[laneID] = l
+	}
+
+	if node, ok := l.keys[key]; ok && key != "" {
+		node.Data = &keyedJob{key: key, job: job}
+		return
+	}
+
+	node := l.jobs.Push(&keyedJob{key: key, job: job})
+	if key != "" {
+		l.keys[key] = node
+	}
+	q.pending++
+
+	if !l.running {
+		l.running = true
+		go q.run(l)
+	}
+}
+
+// Flush Wait until every job sent so far has run
+func (q *Queue) Flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+}
+
+// FlushWithin Wait until every job sent so far has run, or until the timeout. Returns false if it timed out
+func (q *Queue) FlushWithin(timeout time.Duration) bool {
+	flushed := make(chan struct{})
+	go func() {
+		q.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Stop Drop every job that hasn't started yet and stop taking new ones. A job that is running is left to finish
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.isStopped() {
+		return
+	}
+	close(q.stopped)
+	for _, l := range q.lanes {
+		for l.jobs.Pop() != nil {
+			q.pending--
+		}
+		l.keys = make(map[string]*queue.Node)
+	}
+	if q.pending == 0 {
+		q.idle.Broadcast()
+	}
+}
+
+func (q *Queue) isStopped() bool {
+	select {
+	case <-q.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// run Run the jobs in the lane until it is empty. The lane is removed once its bucket is full again, since a new
+// lane would start with a full bucket anyway
+func (q *Queue) run(l *lane) {
+	for {
+		q.mu.Lock()
+		node := l.jobs.Pop()
+		if node == nil {
+			l.running = false
+			time.AfterFunc(l.bucket.UntilFull(), func() { q.removeIdle(l) })
+			q.mu.Unlock()
+			return
+		}
+		next := node.Data.(*keyedJob)
+		if next.key != "" {
+			delete(l.keys, next.key)
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-time.After(l.bucket.Take()):
+		case <-q.stopped:
+			q.mu.Lock()
+			l.running = false
+			q.pending--
+			if q.pending == 0 {
+				q.idle.Broadcast()
+			}
+			q.mu.Unlock()
+			return
+		}
+		if err := next.job(); err != nil {
+			logging.Err(err)
+		}
+
+		q.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// removeIdle Remove the lane if nothing has been sent to it since it ran out of jobs
+func (q *Queue) removeIdle(l *lane) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !l.running && q.lanes[l.id] == l {
+		delete(q.lanes, l.id)
+	}
+}
+
+// Flush Wait until every reply and role change sent so far has run
+func Flush() {
+	Roles.Flush()
+	Replies.Flush()
+}
+
+// Stop Send what is still queued for up to timeout, then drop the rest and stop taking more.
+// Returns false if anything was dropped
+func Stop(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	flushed := Roles.FlushWithin(timeout)
+	flushed = Replies.FlushWithin(time.Until(deadline)) && flushed
+	Roles.Stop()
+	Replies.Stop()
+	return flushed
+}
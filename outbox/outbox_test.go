@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(0, 0)
+
+	var mu sync.Mutex
+	var ran []string
+	record := func(name string) Job {
+		return func() error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	// Hold up the lane so later jobs are still waiting when they are replaced
+	block := make(chan struct{})
+	q.Send("lane", "", func() error {
+		<-block
+		return nil
+	})
+	q.Send("lane", "", record("first"))
+	q.Send("lane", "alice", record("alice 1"))
+	q.Send("lane", "bob", record("bob"))
+	q.Send("lane", "alice", record("alice 2"))
+	q.Send("lane", "", record("last"))
+	close(block)
+	q.Flush()
+
+	expected := []string{"first", "alice 2", "bob", "last"}
+	if len(ran) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, ran)
+	}
+	for k, v := range expected {
+		if ran[k] != v {
+			t.Errorf("Expected %v, got %v", expected, ran)
+			break
+		}
+	}
+
+	// A key that has already run can be sent again
+	q.Send("lane", "alice", record("alice 3"))
+	q.Flush()
+	if ran[len(ran)-1] != "alice 3" {
+		t.Error("Job with a key that already ran was not run")
+	}
+
+	// Lanes are removed once they have nothing left to run
+	deadline := time.Now().Add(time.Second)
+	for q.laneCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if q.laneCount() != 0 {
+		t.Errorf("%v idle lanes were kept", q.laneCount())
+	}
+
+	// One lane waiting on its bucket doesn't hold up another
+	q = NewQueue(time.Hour, 1)
+	defer q.Stop()
+	q.Send("slow", "", record("slow 1"))
+	q.Send("slow", "", record("slow 2"))
+	done := make(chan struct{})
+	q.Send("fast", "", func() error {
+		close(done)
+		return nil
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Lane was held up by another lane")
+	}
+
+	// Stopping drops the jobs still waiting, so flushing doesn't wait for them
+	q.Stop()
+	if !q.FlushWithin(time.Second) {
+		t.Error("Jobs were still waiting after the queue stopped")
+	}
+}
+
+func (q *Queue) laneCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.lanes)
+}
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(20*time.Millisecond, 3)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		b.Wait()
+	}
+	if time.Since(start) > 10*time.Millisecond {
+		t.Error("Burst was limited")
+	}
+	b.Wait()
+	b.Wait()
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("Bucket did not limit after the burst")
+	}
+}
@@ -1,12 +1,9 @@
 package rate
 
 import (
-	"bytes"
 	"fmt"
 	"math"
 	"math/rand"
-	"sort"
-	"text/tabwriter"
 	"time"
 
 	"github.com/Jaggernaut555/respecbot-v2/db"
@@ -40,18 +37,18 @@ func newRespec(user *types.User, channel *types.Channel, rating int) *types.Resp
 	return &respec
 }
 
-// AddRespec Add respec to the message, returns amount actually added
-func AddRespec(user *types.User, channel *types.Channel, rating int) int {
+// AddRespec Add respec to the message, returns amount actually added. at is when whatever earned it happened
+func AddRespec(user *types.User, channel *types.Channel, rating int, at time.Time) int {
 	if user.Bot {
 		return 0
 	}
-	added := addRespecHelp(user, channel, rating)
+	added := addRespecHelp(user, channel, rating, at)
 
 	logging.Log(fmt.Sprintf("%v %+d respec", user.Name, added))
 	return added
 }
 
-func addRespecHelp(user *types.User, channel *types.Channel, rating int) (addedRespec int) {
+func addRespecHelp(user *types.User, channel *types.Channel, rating int, at time.Time) (addedRespec int) {
 	// abs(userRating) / abs(totalRespec)
 	userRespec := db.GetUserLocalRespec(user, channel)
 	added := rating
@@ -77,6 +74,7 @@ func addRespecHelp(user *types.User, channel *types.Channel, rating int) (addedR
 	}
 
 	db.AddRespec(newRespec(user, channel, userRespec+added))
+	db.NewRespecChange(&types.RespecChange{UserKey: user.Key, ChannelKey: channel.Key, Amount: added, Time: at})
 
 	return added
 }
@@ -89,73 +87,33 @@ func RespecMessage(message *types.Message) int {
 
 	respecMentions(message)
 
-	return AddRespec(message.Author, message.Channel, numRespec)
+	return AddRespec(message.Author, message.Channel, numRespec, message.Time)
 }
 
 func respecMentions(message *types.Message) {
 	for _, v := range message.Mentions {
 		if v.ID == message.Author.ID {
 			logging.Log(fmt.Sprintf("%v mentioned themself in channel %v", message.Author, message.ChannelKey))
-			AddRespec(message.Author, message.Channel, -MentionValue)
+			AddRespec(message.Author, message.Channel, -MentionValue, message.Time)
 			continue
 		}
 		logging.Log(fmt.Sprintf("%v Mentioned %v in channel %v\n", message.Author.Name, v.Name, message.ChannelKey))
-		RespecOther(v, message.Channel, MentionValue)
+		RespecOther(v, message.Channel, MentionValue, message.Time)
 	}
 }
 
 // RespecOther Give respec by some other means, ie mentioning.
 // Something that a user has no control and will only be applicable every 5 minutes
-func RespecOther(user *types.User, channel *types.Channel, rating int) (added int) {
+func RespecOther(user *types.User, channel *types.Channel, rating int, at time.Time) (added int) {
 	now := time.Now()
 	last := db.GetLastRespecTime(user, channel)
 	if last != nil {
 		timeDelta := now.Sub(*last)
 		if timeDelta.Minutes() > 5 {
-			return AddRespec(user, channel, rating)
+			return AddRespec(user, channel, rating, at)
 		}
 	} else {
-		return AddRespec(user, channel, rating)
+		return AddRespec(user, channel, rating, at)
 	}
 	return 0
 }
-
-// get all da users in list
-func getRatingsLists(channel *types.Channel, scope types.Scope) (users types.PairList) {
-	switch scope {
-	case types.Local:
-		users = db.GetLocalStats(channel)
-	case types.Guild:
-		users = db.GetServerStats(channel.Server)
-	case types.Global:
-		users = db.GetGlobalStats()
-	}
-	return
-}
-
-// show 10 most RESPEC peep
-func GetRespec(channel *types.Channel, scope types.Scope) (Leaderboard string, negativeUsers []string) {
-	var buf bytes.Buffer
-	negativeUsers = make([]string, 0)
-	users := getRatingsLists(channel, scope)
-
-	sort.Sort(sort.Reverse(users))
-
-	var padding = 3
-	w := new(tabwriter.Writer)
-	w.Init(&buf, 0, 0, padding, ' ', 0)
-	for k, v := range users {
-		if k > 15 {
-			break
-		}
-		if v.Value >= 0 {
-			fmt.Fprintf(w, "%v\t%v\t\n", v.Key, v.Value)
-		} else {
-			negativeUsers = append(negativeUsers, v.Key)
-		}
-	}
-	w.Flush()
-	Leaderboard = fmt.Sprintf("%v", buf.String())
-	sort.Strings(negativeUsers)
-	return
-}
@@ -0,0 +1,29 @@
+package rate
+
+import (
+	"github.com/Jaggernaut555/respecbot-v2/db"
+	"github.com/Jaggernaut555/respecbot-v2/types"
+)
+
+// GetServerTierRoles The names of the server's tiers in order, and the names of the tiers each member is in by user key
+func GetServerTierRoles(server *types.Server) (tierNames []string, memberTiers map[uint][]string) {
+	tiers := db.GetServerTiers(server)
+	for _, v := range tiers {
+		tierNames = append(tierNames, v.Name)
+	}
+
+	// GetServerRespec is ordered by respec, so members are ranked by their position in it
+	respec := db.GetServerRespec(server)
+	total := db.GetTotalServerRespec(server)
+	memberTiers = make(map[uint][]string)
+	above := 0
+	for k, v := range respec {
+		for _, tier := range tiers {
+			if tier.Contains(k+1, v.Respec, len(respec), total, above) {
+				memberTiers[v.UserKey] = append(memberTiers[v.UserKey], tier.Name)
+			}
+		}
+		above += v.Respec
+	}
+	return tierNames, memberTiers
+}
@@ -12,6 +12,11 @@ import (
 	"github.com/Shopify/goluago/util"
 )
 
+const (
+	codeFence = "```"
+	luaFence  = codeFence + "lua"
+)
+
 type argPair struct {
 	name  string
 	value string
@@ -34,42 +39,37 @@ script must include lua tag, only returned values will be printed. returned valu
 
 At least one return MUST be specified
 
-variables must be `name=value`, either int, float, bool, or string
+variables must be `name=value`, either int, float, bool, or string. put quotes around strings with spaces, like `name="some words"`
 return types must be int/float/bool/string
 */
 
-func Lua(api types.API, message *types.Message, args []string) {
-	if len(args) < 1 {
-		api.ReplyTo("Not enough arguments", message)
-		return
+// Lua Run the script in text and build the reply to send back
+func Lua(text string) *types.Reply {
+	if strings.TrimSpace(text) == "" {
+		return types.NewReply("Not enough arguments")
 	}
-	script := getScript(args)
-	if script == nil {
-		api.ReplyTo("Invalid script", message)
-		return
+	script, err := getScript(text)
+	if err != nil {
+		return types.NewReply(err.Error())
 	}
 
 	if !validReturns(script.returns) {
-		api.ReplyTo("Not valid returns", message)
-		return
+		return types.NewReply("Not valid returns")
 	}
 
 	returns, err := callScript(script)
 	if err != nil {
-		api.ReplyTo(err.Error(), message)
 		logging.Err(err)
-		return
+		return types.NewReply(err.Error())
 	}
 
 	err = verifyResults(returns, script.returns)
 	if err != nil {
-		api.ReplyTo(err.Error(), message)
 		logging.Err(err)
-		return
+		return types.NewReply(err.Error())
 	}
 
-	reply := fmt.Sprintf("%+v", returns)
-	api.ReplyTo(reply, message)
+	return &types.Reply{Title: "Lua", Code: fmt.Sprintf("%+v", returns)}
 }
 
 func callScript(script *luaScript) (returnValues []interface{}, err error) {
@@ -149,36 +149,44 @@ func validReturns(args []string) bool {
 	return true
 }
 
-func getScript(args []string) *luaScript {
+// getScript Read the variables and return types written before the lua code block, and the script inside it
+func getScript(text string) (*luaScript, error) {
+	start := strings.Index(text, luaFence)
+	if start < 0 {
+		return nil, fmt.Errorf("Invalid script")
+	}
+	body := text[start+len(luaFence):]
+	end := strings.Index(body, codeFence)
+	if end < 0 {
+		return nil, fmt.Errorf("Invalid script")
+	}
+
 	var script luaScript
-	var startFound, endFound, returnFound bool
-	var start, end int
-	for k, v := range args {
-		if !returnFound && strings.Contains(v, "=") {
-			s := strings.Split(v, "=")
-			if len(s) < 2 {
-				return nil
-			}
-			script.argPairs = append(script.argPairs, argPair{name: s[0], value: s[1]})
-		} else if !returnFound && strings.Contains(v, "return") {
-			returnFound = true
-		} else if returnFound && !startFound && !strings.Contains(v, "```lua") {
+	script.script = body[:end]
+
+	args, err := types.SplitArgs(text[:start])
+	if err != nil {
+		return nil, err
+	}
+	var returnFound bool
+	for _, v := range args {
+		switch {
+		case returnFound:
 			script.returns = append(script.returns, v)
-		} else if !startFound && strings.Contains(v, "```lua") {
-			start = k
-			startFound = true
-		} else if startFound && !endFound && strings.Contains(v, "```") {
-			end = k
-			endFound = true
+		case v == "return":
+			returnFound = true
+		case strings.Contains(v, "="):
+			s := strings.SplitN(v, "=", 2)
+			script.argPairs = append(script.argPairs, argPair{name: s[0], value: s[1]})
+		default:
+			return nil, fmt.Errorf("Variables must be written as name=value")
 		}
-		// add an else { break }?
 	}
-	if !startFound || !endFound || (start >= end) || !returnFound || len(script.returns) == 0 {
-		return nil
+	if !returnFound || len(script.returns) == 0 {
+		return nil, fmt.Errorf("Invalid script")
 	}
-	script.script = strings.Join(args[start+1:end], " ")
 	script.args = convertToInterface(script.argPairs)
-	return &script
+	return &script, nil
 }
 
 // float/string/int/bool
@@ -47,6 +47,21 @@ func TestLua(t *testing.T) {
 		t.Fail()
 	}
 
+	script5, err := getScript("a=1 b=\"two words\" return int string\n```lua\nlocal c = b -- keeps \"quotes\"\nreturn a, c\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script5.argPairs) != 2 || script5.argPairs[1].value != "two words" || len(script5.returns) != 2 {
+		t.Errorf("Script arguments read wrong: %+v", script5)
+	}
+	v5, err := callScript(script5)
+	if err != nil || verifyResults(v5, script5.returns) != nil || v5[1] != "two words" {
+		t.Errorf("Script with quoted string failed: %v %v", v5, err)
+	}
+	if _, err = getScript("a=1 return int"); err == nil {
+		t.Error("Script without a code block was accepted")
+	}
+
 	var script4 luaScript
 	script4.argPairs = []argPair{}
 	script4.returns = []string{"int"}
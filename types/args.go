@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NextArg Read the first argument from text and return it with the rest of the text after it.
+// Arguments are separated by spaces. Anything between double quotes is part of the same argument, including spaces,
+// and a backslash inside quotes keeps the next character as it is. An empty arg and rest means there was nothing left
+func NextArg(text string) (arg, rest string, err error) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	var b []byte
+	quoted := false
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case quoted && r == '\\' && i+size < len(text):
+			next, nextSize := utf8.DecodeRuneInString(text[i+size:])
+			b = append(b, string(next)...)
+			i += size + nextSize
+			continue
+		case r == '"':
+			quoted = !quoted
+		case !quoted && unicode.IsSpace(r):
+			return string(b), text[i:], nil
+		default:
+			b = append(b, text[i:i+size]...)
+		}
+		i += size
+	}
+	if quoted {
+		return "", "", fmt.Errorf("A quote was not closed")
+	}
+	return string(b), "", nil
+}
+
+// SplitArgs Split all of text into arguments the way NextArg does
+func SplitArgs(text string) ([]string, error) {
+	var args []string
+	for strings.TrimSpace(text) != "" {
+		arg, rest, err := NextArg(text)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		text = rest
+	}
+	return args, nil
+}
+
+// QuoteArg Write the value so NextArg reads it back as one argument
+func QuoteArg(value string) string {
+	if value != "" && !strings.ContainsAny(value, "\"\\") && strings.IndexFunc(value, unicode.IsSpace) < 0 {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		args []string
+	}{
+		{"", nil},
+		{"  one two   three ", []string{"one", "two", "three"}},
+		{`add "Supreme Ruler" top 1`, []string{"add", "Supreme Ruler", "top", "1"}},
+		{`name="two words" ""`, []string{"name=two words", ""}},
+		{`"say \"hi\" \\ there"`, []string{`say "hi" \ there`}},
+		{"ünïcode wörds", []string{"ünïcode", "wörds"}},
+	}
+	for _, v := range tests {
+		args, err := SplitArgs(v.text)
+		if err != nil {
+			t.Errorf("%q could not be split: %v", v.text, err)
+			continue
+		}
+		if len(args) != len(v.args) {
+			t.Errorf("%q split into %q, expected %q", v.text, args, v.args)
+			continue
+		}
+		for k := range args {
+			if args[k] != v.args[k] {
+				t.Errorf("%q split into %q, expected %q", v.text, args, v.args)
+				break
+			}
+		}
+	}
+
+	if _, err := SplitArgs(`"not closed`); err == nil {
+		t.Error("Unclosed quote was accepted")
+	}
+
+	for _, v := range []string{"word", "two words", "", `say "hi"`, `back\slash`, "tab\there"} {
+		if arg, rest, err := NextArg(QuoteArg(v) + " next"); arg != v || rest != " next" || err != nil {
+			t.Errorf("%q was quoted as %q and read back as %q", v, QuoteArg(v), arg)
+		}
+	}
+
+	arg, rest, _ := NextArg("lua ```lua\nreturn \"x\"\n```")
+	if arg != "lua" || rest != " ```lua\nreturn \"x\"\n```" {
+		t.Errorf("Rest of the text was changed: %q %q", arg, rest)
+	}
+}
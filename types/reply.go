@@ -0,0 +1,209 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Reply Something the bot sends back. Every API renders it in the way that suits the platform
+type Reply struct {
+	Title  string
+	Text   string
+	Fields []ReplyField
+	// Table Rows of cells, lined up in columns when rendered
+	Table [][]string
+	// Code Shown in a code block after the table
+	Code   string
+	Footer string
+	// Image URL of an image to show with the reply
+	Image string
+	// Color Color of the reply as 0xRRGGBB, on platforms that have one
+	Color int
+	// Paging Set when the reply is one page of many, so platforms that can turn pages do
+	Paging *Paging
+}
+
+// Paging Which page a reply is, and the commands that show the pages around it
+type Paging struct {
+	Page  int
+	Pages int
+	// Previous The command, without a prefix, that shows the page before. Empty on the first page
+	Previous string
+	// Next The command, without a prefix, that shows the page after. Empty on the last page
+	Next string
+}
+
+// ReplyField A named value shown in a reply
+type ReplyField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// NewReply Create a reply that is only text
+func NewReply(text string) *Reply {
+	return &Reply{Text: text}
+}
+
+// NewReplyf Create a reply that is only text, formatted like fmt.Sprintf
+func NewReplyf(format string, a ...interface{}) *Reply {
+	return NewReply(fmt.Sprintf(format, a...))
+}
+
+// IsText Check if the reply only has text, so it can be sent as a normal message
+func (r *Reply) IsText() bool {
+	return r.Title == "" && len(r.Fields) == 0 && len(r.Table) == 0 && r.Code == "" && r.Footer == "" && r.Image == ""
+}
+
+// TableString The table with every column padded to line up
+func (r *Reply) TableString() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	for _, row := range r.Table {
+		fmt.Fprintf(w, "%v\t\n", strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// String Render the reply as plain text
+func (r *Reply) String() string {
+	var parts []string
+	if r.Title != "" {
+		parts = append(parts, r.Title)
+	}
+	if r.Text != "" {
+		parts = append(parts, r.Text)
+	}
+	if len(r.Table) > 0 {
+		parts = append(parts, strings.TrimRight(r.TableString(), "\n"))
+	}
+	if r.Code != "" {
+		parts = append(parts, strings.TrimRight(r.Code, "\n"))
+	}
+	for _, v := range r.Fields {
+		parts = append(parts, fmt.Sprintf("%v: %v", v.Name, v.Value))
+	}
+	if r.Image != "" {
+		parts = append(parts, r.Image)
+	}
+	if r.Footer != "" {
+		parts = append(parts, r.Footer)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// codeFence Starts and ends a code block
+const codeFence = "```"
+
+// SplitMessage Split text into parts no longer than max bytes. Text is split between lines where possible, and any
+// code block open at a split is closed at the end of the part and opened again at the start of the next one.
+// A max of 0 or less means there is no limit
+func SplitMessage(text string, max int) []string {
+	if max <= 0 || len(text) <= max {
+		return []string{text}
+	}
+
+	var parts []string
+	var current []string
+	var currentLen int
+	// fence The line that opened the current code block, or "" if not in one
+	var fence string
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		if fence != "" {
+			current = append(current, codeFence)
+		}
+		parts = append(parts, strings.Join(current, "\n"))
+		current = nil
+		currentLen = 0
+		if fence != "" {
+			current = append(current, fence)
+			currentLen = len(fence)
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// Leave room to open and close a code block around any piece of the line that may be in one
+		width := max
+		if fence != "" || strings.Contains(line, codeFence) {
+			width -= len(fence) + len(codeFence) + 2
+		}
+		for _, piece := range wrapLine(line, width) {
+			next := updateFence(fence, piece)
+			needed := len(piece)
+			if len(current) > 0 {
+				needed++
+			}
+			// Room is kept to close a code block that is still open after this piece
+			closing := 0
+			if next != "" {
+				closing = len(codeFence) + 1
+			}
+			if len(current) > 0 && currentLen+needed+closing > max {
+				flush()
+				needed = len(piece)
+				if len(current) > 0 {
+					needed++
+				}
+			}
+			current = append(current, piece)
+			currentLen += needed
+			fence = next
+		}
+	}
+	// A code block left open by the text itself is not closed
+	fence = ""
+	flush()
+
+	return parts
+}
+
+// updateFence The line opening the code block that is open after the given line
+func updateFence(fence, line string) string {
+	count := strings.Count(line, codeFence)
+	if count%2 == 0 {
+		return fence
+	}
+	if fence != "" {
+		return ""
+	}
+	opening := line[strings.LastIndex(line, codeFence):]
+	if end := strings.IndexAny(opening, " \t"); end >= 0 {
+		opening = opening[:end]
+	}
+	return opening
+}
+
+// wrapLine Split a line into pieces no longer than width bytes, between words where possible
+func wrapLine(line string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var pieces []string
+	for len(line) > width {
+		cut := strings.LastIndex(line[:width+1], " ")
+		if cut <= 0 {
+			// No space to split on, split on the last whole rune that fits instead
+			cut = width
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(line)
+			}
+			pieces = append(pieces, line[:cut])
+			line = line[cut:]
+			continue
+		}
+		pieces = append(pieces, line[:cut])
+		line = line[cut+1:]
+	}
+	return append(pieces, line)
+}
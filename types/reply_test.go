@@ -0,0 +1,58 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	if parts := SplitMessage("short", 10); len(parts) != 1 || parts[0] != "short" {
+		t.Errorf("Short message was split: %q", parts)
+	}
+	if parts := SplitMessage(strings.Repeat("a", 100), 0); len(parts) != 1 {
+		t.Error("Message split without a limit")
+	}
+
+	parts := SplitMessage("one two\nthree four\nfive", 12)
+	if strings.Join(parts, "|") != "one two|three four|five" {
+		t.Errorf("Not split on lines: %q", parts)
+	}
+
+	parts = SplitMessage("one two three four five six", 12)
+	if strings.Join(parts, "|") != "one two|three four|five six" {
+		t.Errorf("Long line not split on words: %q", parts)
+	}
+
+	parts = SplitMessage(strings.Repeat("♡", 10), 12)
+	for _, v := range parts {
+		if !strings.HasPrefix(v, "♡") || len(v) > 12 {
+			t.Errorf("Word split inside a rune or too long: %q", parts)
+		}
+	}
+
+	text := "Leaderboard:\n```lua\n" + strings.Repeat("line of code\n", 20) + "```\nLosers: none"
+	parts = SplitMessage(text, 60)
+	if len(parts) < 2 {
+		t.Fatalf("Code block not split: %q", parts)
+	}
+	var joined []string
+	for k, v := range parts {
+		if len(v) > 60 {
+			t.Errorf("Part %v is %v long", k, len(v))
+		}
+		if strings.Count(v, "```")%2 != 0 {
+			t.Errorf("Part %v has unbalanced code fences: %q", k, v)
+		}
+		if k > 0 && k < len(parts)-1 && !strings.HasPrefix(v, "```lua\n") {
+			t.Errorf("Part %v does not reopen the code block: %q", k, v)
+		}
+		v = strings.TrimPrefix(v, "```lua\n")
+		if k < len(parts)-1 {
+			v = strings.TrimSuffix(v, "\n```")
+		}
+		joined = append(joined, v)
+	}
+	if strings.Count(strings.Join(joined, "\n"), "line of code") != 20 {
+		t.Errorf("Lines lost while splitting: %q", parts)
+	}
+}
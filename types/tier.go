@@ -0,0 +1,145 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Names of the roles in the tiers every server starts with
+const (
+	SupremeRoleName = "Supreme Ruler"
+	RulingRoleName  = "Ruling Class"
+	LoserRoleName   = "Losers"
+)
+
+// TierRule How a tier decides which members of a server are in it
+type TierRule string
+
+// Rules a tier can use. Members are ranked by their respec in the server, starting at 1.
+// Top, percentile, and share tiers only take members with at least Min respec, which is 0 so losers are never in them
+const (
+	// TierTop The Max highest ranked members
+	TierTop TierRule = "top"
+	// TierPercentile The highest ranked Max percent of members
+	TierPercentile TierRule = "percentile"
+	// TierShare The highest ranked members who together hold Max percent of the server's respec
+	TierShare TierRule = "share"
+	// TierScore Members with between Min and Max respec
+	TierScore TierRule = "score"
+	// TierRank Members ranked between Min and Max
+	TierRank TierRule = "rank"
+)
+
+// Limits used by score and rank tiers that are unbounded on one side
+const (
+	TierNoMin = math.MinInt32
+	TierNoMax = math.MaxInt32
+)
+
+// Tier A role given to the members of a server who match its rule. Members get the role of every tier they are in
+type Tier struct {
+	Key       uint    `gorm:"primary_key"`
+	Server    *Server `gorm:"ForeignKey:ServerKey;save_associations:false"`
+	ServerKey uint
+	// Position Order of the tier in its server, starting at 1 for the highest
+	Position int
+	Name     string
+	Rule     TierRule
+	Min      int
+	Max      int
+}
+
+// DefaultTiers The tiers used by a server that hasn't set its own
+func DefaultTiers() []*Tier {
+	return []*Tier{
+		{Position: 1, Name: SupremeRoleName, Rule: TierTop, Min: 0, Max: 1},
+		{Position: 2, Name: RulingRoleName, Rule: TierShare, Min: 0, Max: 50},
+		{Position: 3, Name: LoserRoleName, Rule: TierScore, Min: TierNoMin, Max: -1},
+	}
+}
+
+// Contains Check if a member is in the tier. rank and respec are the member's, members is how many are ranked,
+// total is the server's total positive respec, and above is the respec of every member ranked above them combined
+func (t *Tier) Contains(rank, respec, members, total, above int) bool {
+	switch t.Rule {
+	case TierTop:
+		return respec >= t.Min && rank <= t.Max
+	case TierPercentile:
+		return respec >= t.Min && rank <= int(math.Ceil(float64(members)*float64(t.Max)/100))
+	case TierShare:
+		return respec >= t.Min && above < total*t.Max/100
+	case TierScore:
+		return respec >= t.Min && respec <= t.Max
+	case TierRank:
+		return rank >= t.Min && rank <= t.Max
+	}
+	return false
+}
+
+// RuleString The tier's rule written the same way it is given to the tiers command
+func (t *Tier) RuleString() string {
+	switch t.Rule {
+	case TierTop, TierPercentile, TierShare:
+		return fmt.Sprintf("%v %v", t.Rule, t.Max)
+	case TierScore, TierRank:
+		return fmt.Sprintf("%v %v %v", t.Rule, tierLimitString(t.Min), tierLimitString(t.Max))
+	}
+	return string(t.Rule)
+}
+
+func tierLimitString(limit int) string {
+	if limit == TierNoMin || limit == TierNoMax {
+		return "*"
+	}
+	return strconv.Itoa(limit)
+}
+
+// ParseTierRule Read a rule written like "top 3", "percentile 10", "share 50", "score 100 *", or "rank 2 5".
+// A limit of * means the range is unbounded on that side
+func ParseTierRule(args []string) (rule TierRule, min, max int, err error) {
+	if len(args) < 1 {
+		return "", 0, 0, fmt.Errorf("No rule given")
+	}
+	rule = TierRule(args[0])
+	switch rule {
+	case TierTop, TierPercentile, TierShare:
+		if len(args) != 2 {
+			return "", 0, 0, fmt.Errorf("A %v rule takes one number", rule)
+		}
+		max, err = strconv.Atoi(args[1])
+		if err != nil || max < 1 {
+			return "", 0, 0, fmt.Errorf("%v is not a positive number", args[1])
+		}
+		if rule != TierTop && max > 100 {
+			return "", 0, 0, fmt.Errorf("A %v rule can't be over 100 percent", rule)
+		}
+		return rule, 0, max, nil
+	case TierScore, TierRank:
+		if len(args) != 3 {
+			return "", 0, 0, fmt.Errorf("A %v rule takes a lowest and highest number, use * for no limit", rule)
+		}
+		if min, err = parseTierLimit(args[1], TierNoMin); err != nil {
+			return "", 0, 0, err
+		}
+		if max, err = parseTierLimit(args[2], TierNoMax); err != nil {
+			return "", 0, 0, err
+		}
+		if min > max {
+			return "", 0, 0, fmt.Errorf("The lowest number can't be above the highest")
+		}
+		return rule, min, max, nil
+	}
+	return "", 0, 0, fmt.Errorf("Unknown rule %v, use top, percentile, share, score, or rank", args[0])
+}
+
+func parseTierLimit(arg string, unbounded int) (int, error) {
+	if arg == "*" {
+		return unbounded, nil
+	}
+	limit, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a number", arg)
+	}
+	return limit, nil
+}
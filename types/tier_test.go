@@ -0,0 +1,64 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestTier(t *testing.T) {
+	rule, min, max, err := ParseTierRule([]string{"score", "*", "-1"})
+	if err != nil || rule != TierScore || min != TierNoMin || max != -1 {
+		t.Errorf("Score rule parsed wrong: %v %v %v %v", rule, min, max, err)
+	}
+	tier := &Tier{Rule: rule, Min: min, Max: max}
+	if tier.RuleString() != "score * -1" {
+		t.Errorf("Score rule written wrong: %v", tier.RuleString())
+	}
+	if !tier.Contains(5, -3, 5, 100, 100) || tier.Contains(1, 0, 5, 100, 0) {
+		t.Error("Score rule matched wrong members")
+	}
+
+	// Ruling tiers never take someone with negative respec, even when everyone is negative
+	for _, v := range DefaultTiers()[:2] {
+		if v.Contains(1, -5, 3, 0, 0) {
+			t.Errorf("%v took a member with negative respec", v.Name)
+		}
+	}
+
+	invalid := [][]string{
+		{},
+		{"top"},
+		{"top", "0"},
+		{"percentile", "150"},
+		{"rank", "5", "2"},
+		{"rank", "1"},
+		{"best", "1"},
+	}
+	for _, v := range invalid {
+		if _, _, _, err := ParseTierRule(v); err == nil {
+			t.Errorf("Invalid rule %v was accepted", v)
+		}
+	}
+
+	// Ten members with 10 respec each
+	members, total := 10, 100
+	tests := []struct {
+		tier     Tier
+		included int
+	}{
+		{Tier{Rule: TierTop, Max: 3}, 3},
+		{Tier{Rule: TierPercentile, Max: 25}, 3},
+		{Tier{Rule: TierShare, Max: 50}, 5},
+		{Tier{Rule: TierRank, Min: 2, Max: TierNoMax}, 9},
+	}
+	for _, v := range tests {
+		included := 0
+		for rank := 1; rank <= members; rank++ {
+			if v.tier.Contains(rank, 10, members, total, (rank-1)*10) {
+				included++
+			}
+		}
+		if included != v.included {
+			t.Errorf("%v included %v members, expected %v", v.tier.RuleString(), included, v.included)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Respec struct {
 	Key        uint `gorm:"primary_key"`
@@ -12,12 +15,45 @@ type Respec struct {
 	UpdatedAt  time.Time
 }
 
+// RespecChange Respec a user gained or lost in a channel at some time
+type RespecChange struct {
+	Key        uint `gorm:"primary_key"`
+	UserKey    uint
+	ChannelKey uint
+	Amount     int
+	Time       time.Time
+}
+
 type User struct {
 	Key   uint `gorm:"primary_key;AUTO_INCREMENT"`
 	ID    string
 	Name  string
 	APIID string
 	Bot   bool `gorm:"-"` // This doesn't need to be stored in the database
+	// IdentityKey Key of the user whose identity this account is linked to. 0 if it has not been linked
+	IdentityKey uint
+}
+
+// Reaction A reaction kept so it can be taken back by its ID alone, for APIs that remove reactions that way
+type Reaction struct {
+	Key uint `gorm:"primary_key"`
+	// ID The ID of the reaction on its API
+	ID         string
+	APIID      string
+	GiverID    string
+	Author     *User `gorm:"ForeignKey:AuthorKey;save_associations:false"`
+	AuthorKey  uint
+	ChannelKey uint
+	Time       time.Time
+}
+
+// LinkCode A one-time code that links the account redeeming it to the account that issued it
+type LinkCode struct {
+	Key     uint `gorm:"primary_key"`
+	Code    string
+	User    *User `gorm:"ForeignKey:UserKey;save_associations:false"`
+	UserKey uint
+	Expires time.Time
 }
 
 type Message struct {
@@ -29,8 +65,10 @@ type Message struct {
 	Channel    *Channel `gorm:"ForeignKey:ChannelKey;save_associations:false"`
 	ChannelKey uint
 	Mentions   []*User `gorm:"-"` // This doesn't need to be stored in the database
-	Time       time.Time
-	APIID      string
+	// Addressed The message started by mentioning the bot. The mention is not part of Content
+	Addressed bool `gorm:"-"`
+	Time      time.Time
+	APIID     string
 }
 
 type Channel struct {
@@ -46,19 +84,75 @@ type Server struct {
 	Key   uint `gorm:"primary_key;AUTO_INCREMENT"`
 	ID    string
 	APIID string
+	// CustomTiers Whether the server has set its own tiers instead of using the default ones
+	CustomTiers bool
+	// Prefix What commands start with in the server. "" if it uses the default prefix
+	Prefix string
+	// IgnoreUnknown Whether commands the bot doesn't have go without a reply in the server
+	IgnoreUnknown bool
+}
+
+// Alias A name in a server that runs a command with some arguments already given
+type Alias struct {
+	Key       uint    `gorm:"primary_key"`
+	Server    *Server `gorm:"ForeignKey:ServerKey;save_associations:false"`
+	ServerKey uint
+	Name      string
+	// Command The command and arguments run in place of the alias
+	Command string
 }
 
 type API interface {
 	String() string
 	Setup() error
 	Listen() error
-	ReplyTo(string, *Message) error
+	Close() error
+	ReplyTo(*Reply, *Message) error
+	// MaxMessageLength The longest message the API can send in one go, 0 if there is no limit
+	MaxMessageLength() int
 	HandleCommand(*Message) error
 	GetUser(string) *User
 	GetChannel(string) *Channel
 	GetServer(string) *Server
 }
 
+// PermissionAPI An API that knows what its users are allowed to do
+type PermissionAPI interface {
+	// UserPermission The highest permission the user has in the channel
+	UserPermission(channel *Channel, user *User) (Permission, error)
+}
+
+// IdentityAPI An API whose user IDs can be taken by anyone, like IRC nicks. Owners are matched against who the API has
+// verified a user is instead of their ID
+type IdentityAPI interface {
+	// Identity Who the user has been verified as, or false if they haven't been
+	Identity(user *User) (string, bool)
+}
+
+// RoleAPI An API that can give users named roles in a server
+type RoleAPI interface {
+	AddRole(server *Server, user *User, roleName string) error
+	RemoveRole(server *Server, user *User, roleName string) error
+	// MemberRoles The name of every role the user has in the server
+	MemberRoles(server *Server, user *User) ([]string, error)
+	// SetupRoles Create any of the named roles missing from the server and check that the bot can give them out
+	SetupRoles(server *Server, roleNames []string) (*RoleSetup, error)
+}
+
+// TierAPI An API that is told when a command changes the tiers of a server, so the roles of its members can follow them
+type TierAPI interface {
+	// TiersChanged The tiers of the server changed. Removed has the name of every tier that is gone
+	TiersChanged(server *Server, removed []string)
+}
+
+// RoleSetup What was done and what is still wrong after setting up the roles of a server
+type RoleSetup struct {
+	// Created Roles that were missing and have been created
+	Created []string
+	// Problems Everything stopping the roles being given out, written for the server's admins
+	Problems []string
+}
+
 type Pair struct {
 	Key   string
 	Value int
@@ -84,6 +178,57 @@ const (
 	Global Scope = iota
 )
 
+// Permission What a user is allowed to do. Every permission includes the ones below it
+type Permission uint
+
+const (
+	Everyone    Permission = iota
+	Moderator   Permission = iota
+	ServerAdmin Permission = iota
+	BotOwner    Permission = iota
+)
+
+func (p Permission) String() string {
+	switch p {
+	case Everyone:
+		return "everyone"
+	case Moderator:
+		return "a moderator"
+	case ServerAdmin:
+		return "a server admin"
+	case BotOwner:
+		return "a bot owner"
+	}
+	return "unknown"
+}
+
+// Identity The key shared by every account linked to this user
+func (user *User) Identity() uint {
+	if user.IdentityKey != 0 {
+		return user.IdentityKey
+	}
+	return user.Key
+}
+
+// TrimMention Check if the content starts with any of the given mentions, ignoring case, and remove it.
+// The mention must be followed by a space, ':' or ',' or be the whole content. Other content is returned unchanged
+func TrimMention(content string, mentions ...string) (string, bool) {
+	trimmed := strings.TrimSpace(content)
+	for _, v := range mentions {
+		if v == "" || len(trimmed) < len(v) || !strings.EqualFold(trimmed[:len(v)], v) {
+			continue
+		}
+		rest := trimmed[len(v):]
+		if rest == "" {
+			return rest, true
+		}
+		if strings.IndexAny(rest[:1], " \t:,") == 0 {
+			return strings.TrimSpace(strings.TrimLeft(rest, ":,")), true
+		}
+	}
+	return content, false
+}
+
 func (user *User) UserIn(users []*User) bool {
 	for _, v := range users {
 		if v.Key == user.Key {